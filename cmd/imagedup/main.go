@@ -0,0 +1,15 @@
+// Command imagedup finds images that look alike with perceptual hashing, run imagedup -h for its commands.
+package main
+
+import (
+	"os"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/cli"
+	"github.com/kmulvey/imagedup/v2/internal/app/cli/review"
+	"github.com/kmulvey/imagedup/v2/internal/app/cli/scan"
+	"github.com/kmulvey/imagedup/v2/internal/app/cli/scandirs"
+)
+
+func main() {
+	cli.Main(os.Args[1:], scan.Command, scandirs.Command, review.Command)
+}
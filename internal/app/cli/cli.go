@@ -0,0 +1,198 @@
+// Package cli is what the imagedup commands share: the global flags for logging, metrics and a config file,
+// version printing and running a command by name.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"go.szostok.io/version"
+	"go.szostok.io/version/printer"
+)
+
+// ErrUnknownLogFormat is returned when parsing a log format we do not support.
+var ErrUnknownLogFormat = errors.New("unknown log format")
+
+// Command is a subcommand of imagedup.
+type Command struct {
+	Name    string
+	Summary string // one line for the list of commands
+	// Run parses args, the arguments after the name of the command, and runs it. Errors that end the run are fatal.
+	Run func(g *Globals, args []string)
+}
+
+// Globals are the flags every command takes, they can also be given before the name of the command.
+type Globals struct {
+	LogLevel    log.Level
+	LogFormat   string // text or json
+	MetricsAddr string // empty does not serve metrics
+	ConfigFile  string
+	given       []string // the flags given before the name of the command, -config does not override them
+}
+
+// NewGlobals returns the defaults.
+func NewGlobals() *Globals {
+	return &Globals{LogLevel: log.InfoLevel, LogFormat: "text", MetricsAddr: ":5000"}
+}
+
+// register adds the global flags to fs. Their defaults are the current values, so the ones given
+// before the name of the command are kept.
+func (g *Globals) register(fs *flag.FlagSet) {
+	fs.Func("log-level", "log level: debug, info, warn or error, default "+g.LogLevel.String(), func(level string) (err error) {
+		g.LogLevel, err = log.ParseLevel(level)
+		return err
+	})
+	fs.Func("log-format", "log format: text or json, default "+g.LogFormat, func(format string) error {
+		if format != "text" && format != "json" {
+			return fmt.Errorf("%w: %s", ErrUnknownLogFormat, format)
+		}
+		g.LogFormat = format
+		return nil
+	})
+	fs.StringVar(&g.MetricsAddr, "metrics-addr", g.MetricsAddr, "address to serve prometheus metrics at /metrics on while scanning, empty turns it off")
+	fs.StringVar(&g.ConfigFile, "config", g.ConfigFile, "file of flags to use when they are not given on the command line, one name = value per line. [command] starts the flags of a single command")
+}
+
+// Parse parses the flags of a command along with the global flags, -help and -version, exiting for the last two.
+// Flags that were not given are then set from -config and logging is set up.
+func (g *Globals) Parse(fs *flag.FlagSet, args []string) {
+	var help, v bool
+	g.register(fs)
+	fs.BoolVar(&help, "help", false, "print help")
+	fs.BoolVar(&v, "version", false, "print version")
+	fs.BoolVar(&v, "v", false, "print version")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	if help {
+		fs.PrintDefaults()
+		os.Exit(0)
+	}
+	if v {
+		PrintVersion()
+		os.Exit(0)
+	}
+	if g.ConfigFile != "" {
+		var config, err = ReadConfig(g.ConfigFile)
+		HandleErr("read config", err)
+		HandleErr("apply config", config.Apply(fs, g.given...))
+	}
+	g.setupLogging()
+}
+
+// setupLogging sets the level and format of the log.
+func (g *Globals) setupLogging() {
+	log.SetLevel(g.LogLevel)
+	if g.LogFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+		return
+	}
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp:   true,
+		TimestampFormat: "2006-01-02 15:04:05",
+	})
+}
+
+// StartMetrics serves the prometheus metrics on -metrics-addr in the background.
+func (g *Globals) StartMetrics() {
+	if g.MetricsAddr == "" {
+		return
+	}
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		s := &http.Server{
+			Addr:           g.MetricsAddr,
+			ReadTimeout:    10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			MaxHeaderBytes: 1 << 20,
+		}
+		log.Fatal(s.ListenAndServe())
+	}()
+}
+
+// PrintVersion prints the version and build info.
+func PrintVersion() {
+	var verPrinter = printer.New()
+	var info = version.Get()
+	if err := verPrinter.PrintInfo(os.Stdout, info); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// HandleErr is a convience func to log and quit errors, the ones that only cost a path go through -on-error instead.
+func HandleErr(prefix string, err error) {
+	if err != nil {
+		log.Fatal(fmt.Errorf("%s: %w", prefix, err))
+	}
+}
+
+// Main runs the command named in args, the global flags may come before it: imagedup [flags] command [flags].
+func Main(args []string, commands ...Command) {
+	var g = NewGlobals()
+	var v bool
+	var fs = flag.NewFlagSet("imagedup", flag.ExitOnError)
+	fs.Usage = func() {
+		usage(fs.Output(), fs, commands)
+	}
+	g.register(fs)
+	fs.BoolVar(&v, "version", false, "print version")
+	fs.BoolVar(&v, "v", false, "print version")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if v {
+		PrintVersion()
+		os.Exit(0)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		g.given = append(g.given, f.Name)
+	})
+
+	var name, rest = fs.Arg(0), fs.Args()[min(1, fs.NArg()):]
+	if name == "help" && len(rest) > 0 {
+		name, rest = rest[0], []string{"-help"}
+	}
+	var i = slices.IndexFunc(commands, func(c Command) bool { return c.Name == name })
+	switch {
+	case name == "" || name == "help":
+		usage(os.Stdout, fs, commands)
+		os.Exit(0)
+	case i < 0:
+		_, _ = fmt.Fprintf(fs.Output(), "unknown command %q\n\n", name)
+		fs.Usage()
+		os.Exit(2)
+	}
+	commands[i].Run(g, rest)
+}
+
+// Alias runs a single command as a binary of its own, e.g. nsquared for scan.
+func Alias(command Command, args []string) {
+	command.Run(NewGlobals(), args)
+}
+
+// usage lists the commands and the global flags.
+func usage(w io.Writer, fs *flag.FlagSet, commands []Command) {
+	var names = make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.Name
+	}
+	var width = len(slices.MaxFunc(names, func(a, b string) int { return len(a) - len(b) }))
+
+	_, _ = fmt.Fprintln(w, "usage: imagedup [flags] <command> [flags]\n\ncommands:")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %-*s  %s\n", width, c.Name, c.Summary)
+	}
+	_, _ = fmt.Fprintln(w, "\nrun imagedup help <command> for the flags of a command. flags every command takes:")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	_, _ = fmt.Fprintln(w, "\nthe old binaries nsquared, uniqdirs and verify are the same as imagedup scan, scan-dirs and verify.")
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// not parallel, parsing the global flags sets up the log.
+func TestMainCommand(t *testing.T) {
+	defer func() {
+		log.SetLevel(log.InfoLevel)
+		log.SetFormatter(new(log.TextFormatter))
+	}()
+
+	var fileName = filepath.Join(t.TempDir(), "imagedup.conf")
+	assert.NoError(t, os.WriteFile(fileName, []byte("log-level = debug\nlog-format = json\nmetrics-addr = :6000\n\n[scan]\ndistance = 3\n"), 0600))
+
+	var ran string
+	var globals *Globals
+	var distance int
+	var command = func(name string) Command {
+		return Command{Name: name, Run: func(g *Globals, args []string) {
+			ran, globals = name, g
+			var fs = flag.NewFlagSet(name, flag.ContinueOnError)
+			fs.IntVar(&distance, "distance", 10, "")
+			g.Parse(fs, args)
+		}}
+	}
+	var commands = []Command{command("scan"), command("scan-dirs"), command("verify")}
+
+	// the global flags given before the command win over -config, the ones after it too
+	Main([]string{"-log-level", "warn", "-config", fileName, "scan-dirs", "-metrics-addr", ""}, commands...)
+	assert.Equal(t, "scan-dirs", ran)
+	assert.Equal(t, log.WarnLevel, globals.LogLevel)
+	assert.Equal(t, log.WarnLevel, log.GetLevel())
+	assert.Equal(t, "json", globals.LogFormat)
+	assert.Empty(t, globals.MetricsAddr)
+	assert.Equal(t, 10, distance, "-distance is only set for scan")
+
+	Main([]string{"-config", fileName, "scan", "-log-format", "text"}, commands...)
+	assert.Equal(t, "scan", ran)
+	assert.Equal(t, log.DebugLevel, globals.LogLevel)
+	assert.Equal(t, "text", globals.LogFormat)
+	assert.Equal(t, ":6000", globals.MetricsAddr)
+	assert.Equal(t, 3, distance)
+
+	Main([]string{"verify", "-distance", "5"}, commands...)
+	assert.Equal(t, "verify", ran)
+	assert.Equal(t, NewGlobals(), globals)
+	assert.Equal(t, 5, distance)
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrBadConfig is returned for a config file line we can not use.
+var ErrBadConfig = errors.New("invalid config")
+
+// Setting is a flag set in a config file.
+type Setting struct {
+	Name, Value string
+	Line        int
+}
+
+// Config is the flags of a config file by the command they are for, "" is every command.
+type Config struct {
+	FileName string
+	Commands map[string][]Setting
+}
+
+// ReadConfig reads a config file of name = value lines, a name alone is a boolean flag that is true.
+// # starts a comment and [command] starts the flags of a single command, the flags before the first
+// one are for every command.
+func ReadConfig(fileName string) (Config, error) {
+	// #nosec G304: fileName is given to us by the user.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to open config file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only
+	}()
+
+	var config = Config{FileName: fileName, Commands: make(map[string][]Setting)}
+	var command string
+	var scanner = bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var text, _, _ = strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "["):
+			if !strings.HasSuffix(text, "]") {
+				return Config{}, fmt.Errorf("%w: %s:%d, expected [command]", ErrBadConfig, fileName, line)
+			}
+			command = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+
+		var name, value, found = strings.Cut(text, "=")
+		name, value = strings.TrimPrefix(strings.TrimSpace(name), "-"), strings.TrimSpace(value)
+		if !found {
+			value = "true"
+		}
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return Config{}, fmt.Errorf("%w: %s:%d, expected name = value", ErrBadConfig, fileName, line)
+		}
+		config.Commands[command] = append(config.Commands[command], Setting{Name: name, Value: value, Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return Config{}, fmt.Errorf("unable to read config file: %s, err: %w", fileName, err)
+	}
+	return config, nil
+}
+
+// Apply sets the flags of fs that were not given on the command line, nor are one of given, the flags
+// for every command first. Flags for every command that fs does not have are left out, e.g. -output-dir for scan.
+func (c Config) Apply(fs *flag.FlagSet, given ...string) error {
+	var set = make(map[string]bool)
+	for _, name := range given {
+		set[name] = true
+	}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, command := range []string{"", fs.Name()} {
+		for _, setting := range c.Commands[command] {
+			switch {
+			case set[setting.Name], setting.Name == "config":
+				continue
+			case fs.Lookup(setting.Name) == nil && command == "":
+				continue
+			case fs.Lookup(setting.Name) == nil:
+				return fmt.Errorf("%w: %s:%d, %s has no flag -%s", ErrBadConfig, c.FileName, setting.Line, command, setting.Name)
+			}
+			if err := fs.Set(setting.Name, setting.Value); err != nil {
+				return fmt.Errorf("%w: %s:%d, -%s: %w", ErrBadConfig, c.FileName, setting.Line, setting.Name, err)
+			}
+		}
+	}
+	return nil
+}
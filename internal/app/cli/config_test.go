@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	var fileName = filepath.Join(t.TempDir(), "imagedup.conf")
+	assert.NoError(t, os.WriteFile(fileName, []byte(`# every command
+distance = 5
+output-dir = out # scan has no -output-dir
+log-level = debug
+
+[scan]
+-dir = /photos/2019
+dir = /photos/2020
+sniff
+distance = 3
+`), 0600))
+
+	var config, err = ReadConfig(fileName)
+	assert.NoError(t, err)
+	assert.Len(t, config.Commands[""], 3)
+	assert.Equal(t, Setting{Name: "sniff", Value: "true", Line: 9}, config.Commands["scan"][2])
+
+	var dirs []string
+	var distance int
+	var sniff bool
+	var logLevel string
+	var newFlagSet = func() *flag.FlagSet {
+		dirs, distance, sniff, logLevel = nil, 10, false, "info"
+		var fs = flag.NewFlagSet("scan", flag.ContinueOnError)
+		fs.Func("dir", "", func(dir string) error {
+			dirs = append(dirs, dir)
+			return nil
+		})
+		fs.IntVar(&distance, "distance", distance, "")
+		fs.BoolVar(&sniff, "sniff", sniff, "")
+		fs.StringVar(&logLevel, "log-level", logLevel, "")
+		return fs
+	}
+
+	var fs = newFlagSet()
+	assert.NoError(t, fs.Parse(nil))
+	assert.NoError(t, config.Apply(fs))
+	assert.Equal(t, []string{"/photos/2019", "/photos/2020"}, dirs)
+	assert.Equal(t, 3, distance, "the flags of the command win over the ones for every command")
+	assert.True(t, sniff)
+	assert.Equal(t, "debug", logLevel)
+
+	// the command line wins, also when given before the name of the command
+	fs = newFlagSet()
+	assert.NoError(t, fs.Parse([]string{"-dir", "/incoming", "-distance", "7"}))
+	assert.NoError(t, config.Apply(fs, "log-level"))
+	assert.Equal(t, []string{"/incoming"}, dirs)
+	assert.Equal(t, 7, distance)
+	assert.Equal(t, "info", logLevel)
+
+	// flags of a command it does not have are an error
+	assert.NoError(t, os.WriteFile(fileName, []byte("[scan]\noutput-dir = out\n"), 0600))
+	config, err = ReadConfig(fileName)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, config.Apply(newFlagSet()), ErrBadConfig)
+
+	assert.NoError(t, os.WriteFile(fileName, []byte("[scan\n"), 0600))
+	_, err = ReadConfig(fileName)
+	assert.ErrorIs(t, err, ErrBadConfig)
+
+	assert.NoError(t, os.WriteFile(fileName, []byte("distance = x\n"), 0600))
+	config, err = ReadConfig(fileName)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, config.Apply(newFlagSet()), ErrBadConfig)
+}
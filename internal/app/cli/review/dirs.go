@@ -0,0 +1,136 @@
+package review
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/dirsim"
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/internal/app/verify"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+// processFolderReport reviews the folder pairs found by uniqdirs -similar-dirs one at a time, every
+// matched image of the folder that is not kept is handled like the small image of a pair. The journal
+// lives next to the report so an interrupted review picks up where it left off.
+func processFolderReport(reportFile string, s *session) {
+	var report, err = dirsim.ReadReport(reportFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.journal = openJournal(reportFile)
+	defer closeJournal(s.journal)
+
+	var changed []string
+	for i, match := range report.Matches {
+		if !slices.ContainsFunc(match.Pairs, func(pair logger.DeleteEntry) bool { return !s.folderPairDecided(pair) }) {
+			continue
+		}
+
+		var matchChanged, quit = s.processFolderMatch(i, len(report.Matches), match)
+		changed = append(changed, matchChanged...)
+		if quit {
+			log.Infof("progress saved to %s, run the same command again to continue", s.journal.FileName)
+			break
+		}
+	}
+
+	if len(changed) > 0 {
+		log.Warnf("%d pairs in %s were not touched because they changed since the scan:", len(changed), reportFile)
+		for _, msg := range changed {
+			log.Warn("\t", msg)
+		}
+	}
+}
+
+// folderPairDecided is true when the pair was decided with either folder kept.
+func (s *session) folderPairDecided(pair logger.DeleteEntry) bool {
+	return s.journal.Decided(pair) || s.journal.Decided(logger.DeleteEntry{Big: pair.Small, Small: pair.Big})
+}
+
+// processFolderMatch asks which folder of the match to keep and acts on the matched images of the other.
+// It returns why the pairs that changed since the scan were skipped and whether the reviewer asked to stop.
+func (s *session) processFolderMatch(idx, total int, match dirsim.Match) ([]string, bool) {
+	if err := writeFolderMatch(os.Stdout, match); err != nil {
+		log.Fatal(err)
+	}
+
+	var keep = match.A
+	if match.BBytes > match.ABytes {
+		keep = match.B
+	}
+	if !s.alwaysDelete {
+	prompt:
+		for {
+			switch ask(fmt.Sprintf("[%d/%d]\tkeep which folder? [1/2, b to keep both, q to quit] ", idx+1, total)) {
+			case "1":
+				keep = match.A
+				break prompt
+			case "2":
+				keep = match.B
+				break prompt
+			case "b":
+				for _, pair := range match.Pairs {
+					if !s.folderPairDecided(pair) {
+						s.record(pair, verify.DecisionKept, nil)
+					}
+				}
+				return nil, false
+			case "q":
+				return nil, true
+			}
+		}
+	}
+
+	var changed []string
+	var removed = match.B
+	if keep == match.B {
+		removed = match.A
+	}
+
+	for _, pair := range match.Keep(keep) {
+		if s.folderPairDecided(pair) || s.applier.Gone(pair.Small) || s.applier.Gone(pair.Big) {
+			continue
+		}
+		if rule, protected := s.protect.Match(pair.Small); protected {
+			fmt.Printf("%s skipped, protected by %q\n", pair.Small, rule)
+			continue
+		}
+		if err := pair.CheckIntegrity(); err != nil {
+			fmt.Printf("refusing to touch pair, %s\n", err)
+			changed = append(changed, err.Error())
+			continue
+		}
+		s.apply(pair, "folder duplicate of "+keep)
+	}
+
+	var images = match.AImages
+	if removed == match.B {
+		images = match.BImages
+	}
+	if unmatched := images - len(match.Pairs); unmatched > 0 {
+		log.Infof("%d images in %s have no match in %s and were left in place", unmatched, removed, keep)
+	}
+
+	return changed, false
+}
+
+// writeFolderMatch writes a numbered table of the two folders of a match.
+func writeFolderMatch(w io.Writer, match dirsim.Match) error {
+	fmt.Fprintf(w, "folders are %.0f%% similar\n", match.Score*100)
+	var tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "#\tfolder\timages\tsize\tmatched\n")
+	fmt.Fprintf(tw, "1\t%s\t%d\t%s\t%d\n", match.A, match.AImages, filelist.FormatBytes(match.ABytes), len(match.Pairs))
+	fmt.Fprintf(tw, "2\t%s\t%d\t%s\t%d\n", match.B, match.BImages, filelist.FormatBytes(match.BBytes), len(match.Pairs))
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to write folder table, err: %w", err)
+	}
+	return nil
+}
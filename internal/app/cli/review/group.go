@@ -0,0 +1,172 @@
+package review
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/imagemeta"
+	"github.com/kmulvey/imagedup/v2/internal/app/verify"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+// processClusters reviews the pairs of a log one cluster at a time, clusters whose pairs all
+// have a decision in the journal are skipped. Like processPairs it returns why the clusters that
+// changed since the scan were skipped.
+func processClusters(pairs []logger.DeleteEntry, s *session) []string {
+	var changed []string
+	var clusters = verify.Clusters(pairs)
+
+	for i, cluster := range clusters {
+		if !slices.ContainsFunc(cluster.Pairs, func(pair logger.DeleteEntry) bool { return !s.journal.Decided(pair) }) {
+			continue
+		}
+
+		quit, err := s.processCluster(i, len(clusters), cluster)
+		if err != nil {
+			changed = append(changed, err.Error())
+		}
+		if quit {
+			log.Infof("progress saved to %s, run the same command again to continue", s.journal.FileName)
+			break
+		}
+	}
+
+	return changed
+}
+
+// processCluster shows every member of the cluster, asks which to keep and acts on all the others.
+// quit is true when the reviewer asked to stop.
+func (s *session) processCluster(idx, total int, cluster verify.Cluster) (bool, error) {
+	var members = slices.DeleteFunc(slices.Clone(cluster.Members), s.applier.Gone)
+	if len(members) < 2 {
+		fmt.Printf("[%d/%d]\tonly %d image left in cluster, nothing to do\n", idx+1, total, len(members))
+		s.recordCluster(cluster, verify.DecisionGrouped)
+		return false, nil
+	}
+
+	// make sure we are about to act on the same files that were compared
+	for _, pair := range cluster.Pairs {
+		if s.applier.Gone(pair.Big) || s.applier.Gone(pair.Small) {
+			continue
+		}
+		if err := pair.CheckIntegrity(); err != nil {
+			fmt.Printf("[%d/%d]\trefusing to touch cluster, %s\n", idx+1, total, err)
+			return false, err
+		}
+	}
+
+	var metas = make([]imagemeta.Metadata, len(members))
+	for i, member := range members {
+		metas[i], _ = imagemeta.Read(member) // unreadable fields are shown as unknown
+	}
+	var suggested = verify.SuggestKeeper(metas)
+	if i := slices.IndexFunc(members, cluster.Reference); i >= 0 {
+		suggested = i
+	}
+
+	var keepers = []int{suggested}
+	if !s.alwaysDelete {
+		var quit bool
+		if keepers, quit = s.pickKeepers(idx, total, metas, suggested); quit || keepers == nil {
+			if !quit {
+				s.recordCluster(cluster, verify.DecisionKept)
+			}
+			return quit, nil
+		}
+	}
+
+	var keeperPaths = make([]string, len(keepers))
+	for i, keeper := range keepers {
+		keeperPaths[i] = members[keeper]
+	}
+	var failed []string
+	for i, member := range members {
+		if slices.Contains(keepers, i) {
+			continue
+		}
+		// only members that were compared to a keeper are its duplicates, the others are linked through another member
+		var pair, compared = cluster.Closest(keeperPaths, member)
+		if !compared {
+			fmt.Printf("%s skipped, it was not compared to the image kept\n", member)
+			continue
+		}
+		if cluster.Reference(member) {
+			fmt.Printf("%s skipped, it is in the reference library\n", member)
+			continue
+		}
+		if rule, protected := s.protect.Match(member); protected {
+			fmt.Printf("%s skipped, protected by %q\n", member, rule)
+			continue
+		}
+		if !s.apply(pair, "group review") {
+			failed = append(failed, member)
+		}
+	}
+	s.recordCluster(cluster, verify.DecisionGrouped, failed...)
+
+	return false, nil
+}
+
+// pickKeepers shows the members and asks the reviewer which to keep. keepers is nil when the
+// reviewer chose to skip the cluster and quit is true when they asked to stop.
+func (s *session) pickKeepers(idx, total int, metas []imagemeta.Metadata, suggested int) ([]int, bool) {
+	var paths = make([]string, len(metas))
+	for i, m := range metas {
+		paths[i] = m.Path
+	}
+
+	var viewers []*exec.Cmd
+	var err error
+	if s.terminal {
+		err = showInTerminal(os.Stdout, s.protocol, paths, len(paths)+3) // table and prompt
+	} else {
+		viewers, err = openImages(s.viewer.GroupCommands(paths))
+	}
+	if err != nil {
+		log.Warnf("%s, pick the keepers from the table", err) // a file that can not be shown still gets a decision
+	}
+	defer func() {
+		if err := closeImages(viewers); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if err := verify.WriteGroup(os.Stdout, metas, suggested); err != nil {
+		log.Fatal(err)
+	}
+
+	for {
+		var answer = ask(fmt.Sprintf("[%d/%d]\tkeep which? [1-%d, comma separated, enter for %d, s to skip, q to quit] ", idx+1, total, len(metas), suggested+1))
+		switch answer {
+		case "":
+			return []int{suggested}, false
+		case "s":
+			return nil, false
+		case "q":
+			return nil, true
+		}
+
+		var keepers, err = verify.ParseKeepers(answer, len(metas))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		return keepers, false
+	}
+}
+
+// recordCluster records the decision for every pair of the cluster that does not have one yet. The pairs of
+// failed members, the ones that could not be acted on, are left undecided so the next run reviews them again.
+func (s *session) recordCluster(cluster verify.Cluster, decision verify.Decision, failed ...string) {
+	for _, pair := range cluster.Pairs {
+		if slices.Contains(failed, pair.Big) || slices.Contains(failed, pair.Small) {
+			continue
+		}
+		if !s.journal.Decided(pair) {
+			s.record(pair, decision, nil)
+		}
+	}
+}
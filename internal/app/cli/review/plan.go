@@ -0,0 +1,73 @@
+package review
+
+import (
+	"os"
+	"strings"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/imagedup/v2/internal/app/verify"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+// writePlan saves the plan as json and as a shell script next to it.
+func writePlan(planFile string, plan *verify.Plan) {
+	if err := plan.WriteJSON(planFile); err != nil {
+		log.Fatal(err)
+	}
+
+	var scriptFile = strings.TrimSuffix(planFile, ".json") + ".sh"
+	// #nosec G302 G304: the script is meant to be reviewed and then run by the user.
+	var f, err = os.OpenFile(scriptFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
+	if err != nil {
+		log.Fatalf("unable to create script file: %s, err: %s", scriptFile, err)
+	}
+	if err := plan.WriteScript(f); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("unable to close script file: %s, err: %s", scriptFile, err)
+	}
+
+	log.Infof("planned %d actions, nothing was changed. review %s or %s and run imagedup verify -apply-plan %s to execute it", len(plan.Actions), planFile, scriptFile, planFile)
+}
+
+// applyPlan executes a previously approved plan. Every action is checked again first so files that changed
+// after the plan was written, whose keeper is gone or that are protected, are skipped. Actions that fail are
+// recorded in errs, the ones executed in the journal of the plan so they can be undone.
+func applyPlan(planFile string, protect verify.Protection, errs errorReport) verify.Summary {
+	var summary verify.Summary
+
+	var plan, err = verify.ReadPlan(planFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var journal = openJournal(planFile)
+	defer closeJournal(journal)
+
+	for i, action := range plan.Actions {
+		if rule, protected := protect.Match(action.Path); protected {
+			log.Warnf("[%d/%d] skipped %s, protected by %q", i+1, len(plan.Actions), action.Path, rule)
+			summary.Skipped++
+			continue
+		}
+		if err := action.Check(); err != nil {
+			log.Warnf("[%d/%d] skipped %s, %s", i+1, len(plan.Actions), action.Path, err)
+			summary.Skipped++
+			continue
+		}
+		if err := action.Execute(); err != nil {
+			errs.fail(runerr.New(runerr.StageDelete, action.Path, err))
+			summary.Failed++
+			continue
+		}
+		if err := journal.Record(logger.DeleteEntry{Big: action.Keep, Small: action.Path}, verify.DecisionApplied, &action); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("[%d/%d] %s %s", i+1, len(plan.Actions), action.Op, action.Path)
+		summary.Applied++
+		summary.BytesReclaimed += action.Size
+	}
+
+	return summary
+}
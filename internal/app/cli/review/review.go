@@ -0,0 +1,443 @@
+// Package review is the verify command: it reads the delete logs and reviews the duplicate pairs in them,
+// asking about each one or applying rules, before anything is deleted.
+package review
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/cli"
+	"github.com/kmulvey/imagedup/v2/internal/app/manifest"
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/imagedup/v2/internal/app/termimage"
+	"github.com/kmulvey/imagedup/v2/internal/app/verify"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/kmulvey/path"
+	log "github.com/sirupsen/logrus"
+)
+
+// deleteLogRegex matches the files -delete-files will read when given a dir.
+var deleteLogRegex = regexp.MustCompile(`\.json$`)
+
+// Command is imagedup verify.
+var Command = cli.Command{
+	Name:    "verify",
+	Summary: "review the pairs of the delete logs and delete, trash or quarantine the duplicates",
+	Run:     run,
+}
+
+// run parses the flags of verify and runs it.
+func run(g *cli.Globals, args []string) {
+	var fs = flag.NewFlagSet("verify", flag.ExitOnError)
+	var alwaysDelete bool
+	var deleteFiles path.Entry
+	var rules = verify.Rules{}
+	var queueFile, planFile, applyPlanFile, protectFile string
+	var applier = new(verify.Applier)
+	var undoN int
+	var manifestFile, dirsFile string
+	var viewerTemplate, termGraphics string
+	var group bool
+	var selection verify.Selection
+	var sortOrder string
+	var errs = errorReport{fileName: "verify-errors.json"}
+	var onError runerr.Policy
+	fs.BoolVar(&alwaysDelete, "always-delete", false, "just take the larger one, always")
+	fs.Var(&deleteFiles, "delete-files", "json file where duplicate pairs are stored, same file from -cache-file when running imagedup scan")
+	fs.IntVar(&rules.MaxDistance, "auto-max-distance", -1, "run unattended: delete the small image of pairs with a distance <= this without asking, everything else is queued. -1 disables")
+	fs.BoolVar(&rules.SameAspect, "auto-same-aspect", false, "only auto delete pairs whose images have the same aspect ratio, requires -auto-max-distance")
+	fs.Func("protect", "paths that must never be deleted, glob:pattern (the default when no kind is given) is matched against the full path and the file name, regex:pattern anywhere in the path, prefix:dir everything under dir. can be repeated. files ending in -small.jpg are no longer skipped by default, -protect '*-small.jpg' keeps them", func(rule string) error {
+		var p, err = verify.ParseProtectRule(rule)
+		if err != nil {
+			return err
+		}
+		rules.Protect = append(rules.Protect, p)
+		return nil
+	})
+	fs.StringVar(&protectFile, "protect-file", "", "file of -protect rules, one per line, # starts a comment")
+	fs.StringVar(&queueFile, "queue-file", "", "json file to write pairs that need review when running unattended, defaults to <delete-file>-queue.json")
+	fs.StringVar(&planFile, "plan", "", "dry run: write the planned actions to this json file and a matching .sh script instead of touching any files")
+	fs.StringVar(&applyPlanFile, "apply-plan", "", "execute a plan file previously written with -plan")
+	fs.StringVar(&applier.QuarantineDir, "quarantine-dir", "", "move files under this dir instead of deleting them")
+	fs.BoolVar(&applier.Trash, "trash", false, "move files to the trash instead of deleting them")
+	fs.StringVar(&viewerTemplate, "viewer", viewerForOS(), "command used to show the images, {big} and {small} are replaced with the paths to open both with one command, {} runs the command once per image. the command is not run through a shell. 'terminal' draws the images in the terminal, the default when there is no display")
+	fs.StringVar(&termGraphics, "term-graphics", "auto", "how images are drawn with -viewer terminal: kitty, sixel, ansi or auto to detect it")
+	fs.StringVar(&manifestFile, "manifest", "", "manifest.json written by imagedup scan-dirs, every delete log it lists is processed as if given with -delete-files")
+	fs.StringVar(&dirsFile, "dirs", "", "similar-dirs.json written by imagedup scan-dirs -similar-dirs, review each pair of near duplicate folders as a unit and keep one of them")
+	fs.IntVar(&undoN, "undo", 0, "reverse the last n quarantine or trash actions recorded in the journal of each -delete-files, -dirs or -apply-plan")
+	fs.BoolVar(&group, "group", false, "review whole clusters of duplicates at once and pick the keepers by number, with -always-delete the image with the most pixels in each cluster is kept")
+	fs.StringVar(&sortOrder, "sort", "log", "order to work through the pairs in: log, distance (surest first), savings (most bytes first) or dir")
+	fs.Func("filter", "only work on pairs matching this expression e.g. distance<=3, dir=/photos/2019 or small.size>1MB, can be repeated and all must match", func(expr string) error {
+		var filter, err = verify.ParseFilter(expr)
+		if err != nil {
+			return err
+		}
+		selection.Filters = append(selection.Filters, filter)
+		return nil
+	})
+	fs.Func("on-error", "what to do when a file can not be deleted, trashed or quarantined: continue with the next pair, or fail-fast to stop. default continue", func(policy string) (err error) {
+		onError, err = runerr.ParsePolicy(policy)
+		return err
+	})
+	fs.StringVar(&errs.fileName, "error-file", errs.fileName, "json file to list the files that could not be acted on and why")
+	g.Parse(fs, args)
+
+	errs.Collector = runerr.NewCollector(onError)
+	var err error
+	if selection.Sort, err = verify.ParseSortOrder(sortOrder); err != nil {
+		log.Fatal(err)
+	}
+	if protectFile != "" {
+		var protection, err = verify.LoadProtectFile(protectFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules.Protect = append(rules.Protect, protection...)
+	}
+
+	if alwaysDelete && rules.Enabled() {
+		log.Fatal("-always-delete and -auto-max-distance can not be used together")
+	}
+	if group && rules.Enabled() {
+		log.Fatal("-group and -auto-max-distance can not be used together")
+	}
+	if dirsFile != "" && rules.Enabled() {
+		log.Fatal("-dirs and -auto-max-distance can not be used together")
+	}
+	if applier.Trash && applier.QuarantineDir != "" {
+		log.Fatal("-trash and -quarantine-dir can not be used together")
+	}
+	if applyPlanFile != "" && undoN > 0 {
+		undo(applyPlanFile, undoN)
+		return
+	}
+	if applyPlanFile != "" {
+		log.Info(applyPlan(applyPlanFile, rules.Protect, errs))
+		errs.write()
+		return
+	}
+	if planFile != "" {
+		if filepath.Ext(planFile) != ".json" {
+			log.Fatal("plan file must have extension .json")
+		}
+		applier.Plan = &verify.Plan{Created: time.Now()}
+	}
+
+	var files []path.Entry
+	if deleteFiles.AbsolutePath != "" {
+		if files, err = deleteFiles.Flatten(true); err != nil {
+			log.Fatal("error flattening files: ", err)
+		}
+		// journals live next to the delete logs, dont try to read them as one
+		files = path.FilterEntities(files, path.NewRegexEntitiesFilter(deleteLogRegex))
+	}
+	if manifestFile != "" {
+		files = append(files, manifestDeleteLogs(manifestFile)...)
+	}
+	if len(files) == 0 && dirsFile == "" {
+		log.Fatal("no delete logs to process, use -delete-files, -manifest or -dirs")
+	}
+
+	if undoN > 0 {
+		for _, deleteFile := range files {
+			undo(deleteFile.AbsolutePath, undoN)
+		}
+		if dirsFile != "" {
+			undo(dirsFile, undoN)
+		}
+		return
+	}
+
+	if rules.Enabled() {
+		log.Info(runUnattended(files, selection, queueFile, rules, applier, errs))
+	} else {
+		var s = &session{applier: applier, errs: errs, protect: rules.Protect, selection: selection, alwaysDelete: alwaysDelete, group: group}
+		if !alwaysDelete && viewerTemplate == viewerTerminal {
+			s.terminal = true
+			if s.protocol, err = termimage.ParseProtocol(termGraphics); err != nil {
+				log.Fatal(err)
+			}
+		} else if !alwaysDelete {
+			if s.viewer, err = verify.ParseViewer(viewerTemplate); err != nil {
+				log.Fatal(err, ", set one with -viewer")
+			}
+		}
+		for _, deleteFile := range files {
+			processDeleteFile(deleteFile.AbsolutePath, s)
+		}
+		if dirsFile != "" {
+			processFolderReport(dirsFile, s)
+		}
+	}
+
+	if applier.Plan != nil {
+		writePlan(planFile, applier.Plan)
+	}
+	errs.write()
+}
+
+// errorReport records the files a run could not act on and writes them to fileName.
+type errorReport struct {
+	*runerr.Collector
+	fileName string
+}
+
+// fail records err, the run goes on with the next pair unless -on-error is fail-fast. Then the report is
+// written and the run stops, the journal has every decision made so far.
+func (r errorReport) fail(err error) {
+	if err := r.Record(err); err != nil {
+		r.write()
+		log.Fatalf("stopped at the first error as -on-error is fail-fast, run the same command again to continue: %s", err)
+	}
+}
+
+// write writes the report, the report of an earlier run is removed when there are no errors.
+func (r errorReport) write() {
+	if err := r.Write(r.fileName); err != nil {
+		log.Error(err)
+		return
+	}
+	if r.Len() > 0 {
+		log.Warnf("%d errors, see %s", r.Len(), r.fileName)
+	}
+}
+
+// manifestDeleteLogs returns the delete logs listed in a uniqdirs manifest.
+func manifestDeleteLogs(manifestFile string) []path.Entry {
+	var m, err = manifest.Read(manifestFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var files []path.Entry
+	for _, deleteLog := range m.DeleteLogs() {
+		var entry, err = path.NewEntry(deleteLog, 0)
+		if err != nil {
+			log.Warnf("skipping %s listed in %s, err: %s", deleteLog, manifestFile, err)
+			continue
+		}
+		files = append(files, entry)
+	}
+	return files
+}
+
+// session holds the settings shared by every pair in a run.
+type session struct {
+	applier      *verify.Applier
+	errs         errorReport
+	journal      *verify.Journal
+	protect      verify.Protection
+	selection    verify.Selection
+	viewer       verify.Viewer
+	terminal     bool
+	protocol     termimage.Protocol
+	alwaysDelete bool
+	group        bool
+}
+
+// processDeleteFile loads a log file and processes every selected duplicate pair in it, pairs that
+// already have a decision in the journal are skipped so an interrupted run picks up where it left off.
+func processDeleteFile(path string, s *session) {
+	var dedupedFiles, err = logger.ReadDeleteLogFile(path)
+	if err != nil {
+		log.Fatalf("error reading file: %s, err: %s", path, err)
+	}
+	dedupedFiles = s.selection.Apply(dedupedFiles)
+
+	s.journal = openJournal(path)
+	defer closeJournal(s.journal)
+
+	var changed []string
+	if s.group {
+		changed = processClusters(dedupedFiles, s)
+	} else {
+		changed = processPairs(path, dedupedFiles, s)
+	}
+
+	if len(changed) > 0 {
+		log.Warnf("%d pairs in %s were not touched because they changed since the scan:", len(changed), path)
+		for _, msg := range changed {
+			log.Warn("\t", msg)
+		}
+	}
+}
+
+// processPairs reviews the pairs of a log one at a time and returns why the pairs that changed since the scan were skipped.
+func processPairs(path string, dedupedFiles []logger.DeleteEntry, s *session) []string {
+	var changed []string
+	var resumed bool
+
+	for i, pair := range dedupedFiles {
+		if s.journal.Decided(pair) {
+			continue
+		}
+		if i > 0 && !resumed {
+			log.Infof("resuming %s at pair %d, earlier decisions are in %s", path, i+1, s.journal.FileName)
+		}
+		resumed = true
+
+		quit, err := s.processPair(i, len(dedupedFiles), pair)
+		if err != nil {
+			changed = append(changed, err.Error())
+		}
+		if quit {
+			log.Infof("progress saved to %s, run the same command again to continue", s.journal.FileName)
+			break
+		}
+	}
+
+	return changed
+}
+
+// openJournal opens the journal that goes with the delete log.
+func openJournal(deleteLog string) *verify.Journal {
+	var journal, err = verify.OpenJournal(verify.JournalFileName(deleteLog))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return journal
+}
+
+// closeJournal closes the journal, errors are logged as there is nothing left to do about them.
+func closeJournal(journal *verify.Journal) {
+	if err := journal.Close(); err != nil {
+		log.Error(err)
+	}
+}
+
+// undo reverses the last n quarantine or trash actions recorded in the journal of the delete log.
+func undo(deleteLog string, n int) {
+	var journal = openJournal(deleteLog)
+	defer closeJournal(journal)
+
+	var undone, err = journal.Undo(n)
+	for _, action := range undone {
+		log.Infof("restored %s", action.Path)
+	}
+	if errors.Is(err, verify.ErrNothingToUndo) {
+		log.Warn(err)
+	} else if err != nil {
+		log.Error(err)
+	}
+}
+
+// processPair handles a single duplicate pair: skip, auto-delete, or interactive review.
+// An error is returned when either file no longer matches its scan snapshot, the pair is left untouched.
+// quit is true when the reviewer asked to stop.
+func (s *session) processPair(idx, total int, pair logger.DeleteEntry) (bool, error) {
+	// skip pairs that have already been handled
+	if s.applier.Gone(pair.Small) {
+		fmt.Printf("%s already deleted\n", pair.Small)
+		return false, nil
+	}
+	if s.applier.Gone(pair.Big) {
+		fmt.Printf("%s already deleted\n", pair.Big)
+		return false, nil
+	}
+	if rule, protected := s.protect.Match(pair.Small); protected {
+		fmt.Printf("%s skipped, protected by %q\n", pair.Small, rule)
+		return false, nil
+	}
+
+	// make sure we are about to act on the same files that were compared
+	if err := pair.CheckIntegrity(); err != nil {
+		fmt.Printf("[%d/%d]\trefusing to touch pair, %s\n", idx+1, total, err)
+		return false, err
+	}
+
+	if s.alwaysDelete {
+		s.apply(pair, "always delete")
+		return false, nil
+	}
+
+	return s.reviewPairInteractive(idx, total, pair), nil
+}
+
+// apply acts on the small image of the pair and records it in the journal. A pair that fails is left undecided
+// so the next run tries it again, ok is false then.
+func (s *session) apply(pair logger.DeleteEntry, reason string) bool {
+	var action, err = s.applier.Act(pair, reason)
+	if err != nil {
+		s.errs.fail(runerr.New(runerr.StageDelete, pair.Small, err))
+		return false
+	}
+	s.record(pair, verify.DecisionApplied, &action)
+	log.Infof("%s %s", s.applier.Verb(), pair.Small)
+	return true
+}
+
+// record writes the decision to the journal, dry runs are not recorded as nothing was done.
+func (s *session) record(pair logger.DeleteEntry, decision verify.Decision, action *verify.Action) {
+	if s.applier.Plan != nil {
+		return
+	}
+	if err := s.journal.Record(pair, decision, action); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// reviewPairInteractive opens both images in a viewer, prints the metadata table and asks the user whether to delete.
+// It returns true if the user wants to quit.
+func (s *session) reviewPairInteractive(idx, total int, pair logger.DeleteEntry) bool {
+	var viewers []*exec.Cmd
+	var err error
+	if s.terminal {
+		err = showInTerminal(os.Stdout, s.protocol, []string{pair.Big, pair.Small}, 14) // table and prompt
+	} else {
+		viewers, err = openImages(s.viewer.Commands(pair.Big, pair.Small))
+	}
+	if err != nil {
+		log.Warnf("%s, review the pair from the table", err) // a file that can not be shown still gets a decision
+	}
+	if err := writeComparison(os.Stdout, pair); err != nil {
+		log.Fatal(err)
+	}
+
+	// only an explicit n is recorded, a typo would hide the pair from every later run
+	var quit bool
+prompt:
+	for {
+		switch ask(fmt.Sprintf("[%d/%d]\tdelete: %s ? [y/n/q] ", idx+1, total, pair.Small)) {
+		case "y":
+			s.apply(pair, "reviewed")
+			break prompt
+		case "n":
+			s.record(pair, verify.DecisionKept, nil)
+			break prompt
+		case "q":
+			quit = true
+			break prompt
+		}
+	}
+
+	if err := closeImages(viewers); err != nil {
+		log.Fatal(err)
+	}
+
+	return quit
+}
+
+// stdin is shared by every prompt so buffered input is not lost between them.
+var stdin = bufio.NewReader(os.Stdin)
+
+// ask prints the prompt and returns the trimmed answer, EOF is treated as quit.
+func ask(prompt string) string {
+	fmt.Print(prompt)
+	var answer, err = stdin.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "q"
+		}
+		log.Fatalf("unable to read input, err: %s", err)
+	}
+	return strings.TrimSpace(answer)
+}
@@ -0,0 +1,72 @@
+package review
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/termimage"
+	"github.com/kmulvey/imagedup/v2/internal/app/verify"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// viewerTerminal is the -viewer value that draws the images in the terminal instead of starting a viewer.
+const viewerTerminal = "terminal"
+
+// previewBox is the largest size, in pixels, each image is scaled to before being drawn, the terminal is always smaller.
+const previewBox = 800
+
+// gridColumns is the most images drawn next to each other when showing a cluster in the terminal.
+const gridColumns = 4
+
+// showInTerminal draws the images left to right, wrapping to a new row after gridColumns,
+// leaving reserved rows of the terminal free for the table and the prompt.
+func showInTerminal(w io.Writer, protocol termimage.Protocol, paths []string, reserved int) error {
+	var size = termimage.TerminalSize(os.Stdout)
+	var rows = max(size.Rows-reserved, 6)
+
+	var images = make([]image.Image, 0, len(paths))
+	for _, fileName := range paths {
+		var img, err = decodeImage(fileName)
+		if err != nil {
+			return err
+		}
+		images = append(images, img)
+	}
+
+	var canvas = termimage.Grid(images, gridColumns, previewBox, previewBox, previewBox/20)
+	return termimage.Render(w, canvas, protocol, size, size.Cols, rows)
+}
+
+// decodeImage decodes the whole image.
+func decodeImage(fileName string) (image.Image, error) {
+	// #nosec G304: fileName comes from the delete log written by nsquared or uniqdirs.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only, nothing to flush
+	}()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image: %s, err: %w", fileName, err)
+	}
+	return img, nil
+}
+
+// writeComparison writes the metadata table for the pair, differences are highlighted when stdout is a terminal.
+func writeComparison(w io.Writer, pair logger.DeleteEntry) error {
+	return verify.Compare(pair).Write(w, isTerminal(os.Stdout))
+}
+
+// isTerminal returns true if f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	var info, err = f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
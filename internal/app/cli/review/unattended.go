@@ -0,0 +1,130 @@
+package review
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/imagedup/v2/internal/app/verify"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/kmulvey/path"
+	log "github.com/sirupsen/logrus"
+)
+
+// runUnattended applies the rules to every selected pair in every delete file without asking. Pairs that need
+// a human are written to queueFile, or to <delete-file>-queue.json when queueFile is empty. Pairs that fail
+// are recorded in errs.
+func runUnattended(files []path.Entry, selection verify.Selection, queueFile string, rules verify.Rules, applier *verify.Applier, errs errorReport) verify.Summary {
+	var summary verify.Summary
+	var queue *logger.DeleteLogger
+	var err error
+
+	if queueFile != "" {
+		queue, err = logger.NewDeleteLogger(queueFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, deleteFile := range files {
+		var fileQueue = queue
+		if fileQueue == nil {
+			fileQueue, err = logger.NewDeleteLogger(strings.TrimSuffix(deleteFile.AbsolutePath, ".json") + "-queue.json")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		summary.Add(processDeleteFileUnattended(deleteFile.AbsolutePath, selection, fileQueue, rules, applier, errs))
+
+		if queue == nil {
+			closeQueue(fileQueue)
+		}
+	}
+
+	if queue != nil {
+		closeQueue(queue)
+	}
+
+	return summary
+}
+
+// processDeleteFileUnattended loads a log file and applies the rules to every selected pair in it.
+func processDeleteFileUnattended(path string, selection verify.Selection, queue *logger.DeleteLogger, rules verify.Rules, applier *verify.Applier, errs errorReport) verify.Summary {
+	var summary verify.Summary
+
+	var dedupedFiles, err = logger.ReadDeleteLogFile(path)
+	if err != nil {
+		log.Fatalf("error reading file: %s, err: %s", path, err)
+	}
+	dedupedFiles = selection.Apply(dedupedFiles)
+
+	var journal = openJournal(path)
+	defer closeJournal(journal)
+
+	for i, pair := range dedupedFiles {
+		var prefix = fmt.Sprintf("[%d/%d]", i+1, len(dedupedFiles))
+
+		if journal.Decided(pair) {
+			continue
+		}
+
+		if applier.Gone(pair.Small) || applier.Gone(pair.Big) {
+			log.Infof("%s skipped, already deleted: %s", prefix, pair.Small)
+			summary.Skipped++
+			continue
+		}
+		if err := pair.CheckIntegrity(); err != nil {
+			log.Warnf("%s skipped, %s", prefix, err)
+			summary.Skipped++
+			continue
+		}
+
+		var outcome, reason = rules.Evaluate(pair)
+		switch outcome {
+		case verify.Skip:
+			log.Infof("%s skipped %s, %s", prefix, pair.Small, reason)
+			summary.Skipped++
+
+		case verify.Queue:
+			if err := queue.LogEntry(pair); err != nil {
+				log.Fatal(err)
+			}
+			log.Infof("%s queued %s, %s", prefix, pair.Small, reason)
+			summary.Queued++
+
+		case verify.Apply:
+			var action, err = applier.Act(pair, reason)
+			if err != nil {
+				errs.fail(runerr.New(runerr.StageDelete, pair.Small, err))
+				summary.Failed++
+				continue
+			}
+			if applier.Plan == nil {
+				if err := journal.Record(pair, verify.DecisionApplied, &action); err != nil {
+					log.Fatal(err)
+				}
+			}
+			log.Infof("%s %s %s, %s", prefix, applier.Verb(), pair.Small, reason)
+			summary.Applied++
+			summary.BytesReclaimed += action.Size
+		}
+	}
+
+	return summary
+}
+
+// closeQueue closes the queue log and removes it if nothing was queued.
+func closeQueue(queue *logger.DeleteLogger) {
+	if err := queue.Close(); err != nil {
+		log.Error(err)
+	}
+	if queue.FirstEntry {
+		if err := os.Remove(queue.FileName); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+	log.Infof("pairs that need review were written to %s, run imagedup verify -delete-files %s to review them", queue.FileName, queue.FileName)
+}
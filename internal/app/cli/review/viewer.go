@@ -0,0 +1,60 @@
+package review
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// viewerForOS returns the default image viewer template for the current OS. Without a display,
+// e.g. over ssh, the images are drawn in the terminal.
+func viewerForOS() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "preview {}"
+	case "windows":
+		return ""
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return viewerTerminal
+		}
+		return "eog {}" // eog -- GNOME Image Viewer 41.1
+	}
+}
+
+// openImages starts the viewer commands built by verify.Viewer.
+func openImages(commands [][]string) ([]*exec.Cmd, error) {
+	var processes []*exec.Cmd
+
+	for _, argv := range commands {
+		// #nosec G204: the viewer is chosen by the user running the CLI and the argv is built
+		// directly, no shell is involved so the image paths can not inject anything.
+		var process = exec.Command(argv[0], argv[1:]...)
+		if err := process.Start(); err != nil {
+			_ = closeImages(processes) // already returning the more useful error
+			return nil, fmt.Errorf("error opening images with %q, err: %w", argv, err)
+		}
+		processes = append(processes, process)
+	}
+
+	return processes, nil
+}
+
+// closeImages kills the viewers, viewers that already exited on their own are fine.
+func closeImages(processes []*exec.Cmd) error {
+	for _, process := range processes {
+		if err := process.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("error killing process: %w", err)
+		}
+
+		if err := process.Wait(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return fmt.Errorf("error waiting for process: %w", err)
+			}
+		}
+	}
+	return nil
+}
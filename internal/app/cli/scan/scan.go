@@ -0,0 +1,383 @@
+// Package scan is the scan command, once nsquared: it compares every image to every other one and writes
+// the duplicate pairs to a delete log.
+package scan
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/cli"
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
+	"github.com/kmulvey/imagedup/v2/internal/app/manifest"
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/kmulvey/path"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkpointInterval is how often the progress of a run is saved.
+const checkpointInterval = time.Minute
+
+// Command is imagedup scan.
+var Command = cli.Command{
+	Name:    "scan",
+	Summary: "compare every image in the dirs to every other one and write the duplicate pairs to a delete log",
+	Run:     run,
+}
+
+// run parses the flags of scan and runs it.
+func run(g *cli.Globals, args []string) {
+	var start = time.Now()
+	var ctx, cancel = context.WithCancel(context.Background())
+
+	var gracefulShutdown = make(chan os.Signal, 1)
+	signal.Notify(gracefulShutdown, os.Interrupt, syscall.SIGTERM)
+
+	var c = parseFlags(g, args)
+	g.StartMetrics()
+	var errs = runerr.NewCollector(c.OnError)
+	if c.resume {
+		// the pairs before the checkpoint are not compared again, the files are listed again
+		var previous, err = runerr.Previous(c.errorFile)
+		cli.HandleErr("read error report", err)
+		errs.Carry(previous, func(entry runerr.Entry) bool { return entry.Stage != runerr.StageList })
+	}
+
+	var listing = listFiles(c, errs)
+	var skipped = listing.Skipped
+
+	var reference []string
+	var referenceCache *hash.Cache
+	if c.against() {
+		reference, referenceCache = loadReference(c, errs, &listing)
+		log.Infof("Comparing to %d reference images", len(reference))
+	}
+	cli.WriteLinked(c.linkedFile, listing.Linked)
+
+	id, err := imagedup.NewImageDup(metrics.Options{Namespace: "imagedup"}, c.cacheFile, c.threads, len(listing.Files), c.distanceThreshold, c.dedupFilePairs)
+	cli.HandleErr("NewImageDup", err)
+	cli.DropChanged(id.HashCache, listing.Files)
+	if referenceCache != nil {
+		id.SetReferenceCache(referenceCache)
+	}
+
+	var files = c.Filter.Apply(listing.Files, id.HashCache.Dimensions, skipped)
+	var fileNames = path.OnlyNames(files)
+	log.Infof("Found %d files, skipped: %s", len(files), skipped)
+	if len(files) < 2 {
+		log.Fatalf("Skipping because there are only %d files", len(files))
+	}
+
+	var previous = readCheckpoint(c.checkpointFile)
+	var checkpoint = &imagedup.Checkpoint{Fingerprint: fingerprint(files, reference, c.distanceThreshold), DedupPairs: c.dedupFilePairs, Incremental: c.incremental, Files: len(files), Completed: previous.Completed}
+	var resumed = c.resume && resumeFrom(c.checkpointFile, previous, checkpoint)
+	if c.incremental && !resumed {
+		if !previous.Finished() {
+			log.Fatalf("the run in %s did not finish, continue it with -resume or run without -incremental to compare every file", c.checkpointFile)
+		}
+		checkpoint.NewFiles = checkpoint.Changed(fileNames, fileStates(files))
+		log.Infof("%d of %d files are new or changed since the last run that finished", len(checkpoint.NewFiles), len(files))
+	}
+
+	var resultsLogger *logger.DeleteLogger
+	if c.resume {
+		resultsLogger, err = logger.AppendDeleteLogger(c.outputFile)
+		cli.HandleErr("AppendDeleteLogger", err)
+	} else {
+		resultsLogger, err = logger.NewDeleteLogger(c.outputFile)
+		cli.HandleErr("NewDeleteLogger", err)
+	}
+	// written right away so an old checkpoint never resumes a log that was just truncated
+	cli.HandleErr("write checkpoint", checkpoint.Write(c.checkpointFile))
+
+	var results chan hash.DiffResult
+	var errors chan error
+	switch {
+	case c.against():
+		results, errors = id.RunAgainst(ctx, fileNames, reference, checkpoint.RowsDone)
+	case c.incremental:
+		results, errors = id.RunIncremental(ctx, fileNames, checkpoint.NewFiles, checkpoint.RowsDone)
+	default:
+		results, errors = id.RunFrom(ctx, fileNames, checkpoint.RowsDone)
+	}
+	log.Info("Started, go to grafana to monitor")
+
+	var stopped = collectResults(results, errors, resultsLogger, id, errs, gracefulShutdown, func() {
+		checkpoint.RowsDone = id.RowsDone()
+		if err := checkpoint.Write(c.checkpointFile); err != nil {
+			log.Error(err)
+		}
+	})
+
+	log.Info("Shutting down")
+	cancel()
+	if err = id.Shutdown(); err != nil {
+		log.Fatal("error shutting down", err)
+	}
+	if referenceCache != nil {
+		cli.HandleErr("persist reference cache", referenceCache.Persist())
+	}
+	if err := resultsLogger.Close(); err != nil {
+		log.Error(err)
+	}
+	checkpoint.RowsDone = id.RowsDone()
+	if stopped == nil && checkpoint.Finished() && !c.against() {
+		checkpoint.Completed = fileStates(files)
+	}
+	cli.HandleErr("write checkpoint", checkpoint.Write(c.checkpointFile))
+	cli.WriteErrors(c.errorFile, errs)
+	if stopped != nil {
+		log.Fatalf("Stopped at the first error after %d of %d files as -on-error is fail-fast, continue with the same flags and -resume: %s", checkpoint.RowsDone, checkpoint.Rows(), stopped)
+	}
+	if checkpoint.RowsDone < checkpoint.Rows() {
+		log.Infof("Stopped after %d of %d files, continue with the same flags and -resume", checkpoint.RowsDone, checkpoint.Rows())
+	}
+	log.Infof("Total time taken: %s, paths skipped: %s, already linked: %d, errors: %d", time.Since(start), skipped, listing.Linked.Paths(), errs.Len())
+}
+
+// listFiles lists the images in every -dir and -files-from, each file only once, along with the paths it skipped
+// and the ones that are links to a listed file. Paths that can not be read go to errs.
+func listFiles(c config, errs *runerr.Collector) filelist.Listing {
+	var sources = c.Sources(c.depth, c.dirs...)
+	sources.OnError = errs.Record
+	if c.filesFrom != "" {
+		var list, err = filelist.Open(c.filesFrom)
+		cli.HandleErr("open files-from", err)
+		defer func() {
+			_ = list.Close() // read only
+		}()
+		sources.FilesFrom = list
+	}
+
+	var listing, err = sources.List()
+	if err != nil {
+		cli.WriteErrors(c.errorFile, errs)
+	}
+	cli.HandleErr("listFiles", err)
+	cli.WarnMismatched(listing)
+	return listing
+}
+
+// fingerprint identifies the file list, reference library and distance of a run.
+func fingerprint(files []path.Entry, reference []string, distanceThreshold int) string {
+	var states = make([]manifest.FileState, 0, len(files)+len(reference))
+	for _, file := range files {
+		states = append(states, manifest.FileState{Path: file.AbsolutePath, Size: file.FileInfo.Size(), ModTime: file.FileInfo.ModTime()})
+	}
+	for _, file := range reference {
+		states = append(states, manifest.FileState{Path: "reference:" + file})
+	}
+	return manifest.Fingerprint(distanceThreshold, states)
+}
+
+// loadReference returns the images of the reference library and the cache to hash them with,
+// the cache is nil when they share -cache-file with the files being deduped. Files that are also in the
+// reference library, through a link or the same path, are dropped from the listing.
+func loadReference(c config, errs *runerr.Collector, listing *filelist.Listing) ([]string, *hash.Cache) {
+	var referenceCache *hash.Cache
+	if c.againstCache != "" {
+		var err error
+		// the metric names are the same as the ones of -cache-file, the label tells them apart
+		referenceCache, err = hash.NewCache(c.againstCache, metrics.Options{Namespace: "imagedup"}.With("cache", "reference"), 0)
+		cli.HandleErr("load reference cache", err)
+	}
+
+	if c.againstDir == "" {
+		return referenceCache.Files(), referenceCache
+	}
+
+	var sources = c.Sources(c.depth, c.againstDir)
+	sources.OnError = errs.Record
+	var reference, err = sources.List()
+	if err != nil {
+		cli.WriteErrors(c.errorFile, errs)
+	}
+	cli.HandleErr("list reference files", err)
+	cli.WarnMismatched(reference)
+	listing.Skipped.Add(reference.Skipped)
+	listing.DropLinked(reference.Files)
+	if referenceCache != nil {
+		cli.DropChanged(referenceCache, reference.Files)
+	}
+	return path.OnlyNames(reference.Files), referenceCache
+}
+
+// readCheckpoint reads the checkpoint of the last run, an empty one that is finished when there was none.
+func readCheckpoint(checkpointFile string) *imagedup.Checkpoint {
+	var previous, err = imagedup.ReadCheckpoint(checkpointFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return new(imagedup.Checkpoint)
+	}
+	cli.HandleErr("read checkpoint", err)
+	return previous
+}
+
+// resumeFrom sets the row to continue at from the checkpoint of an earlier run and returns true, a missing
+// checkpoint starts over. An incremental run continues with the new files of the earlier run.
+func resumeFrom(checkpointFile string, previous, current *imagedup.Checkpoint) bool {
+	if previous.Fingerprint == "" {
+		log.Warnf("no checkpoint at %s, starting from the beginning", checkpointFile)
+		return false
+	}
+
+	var row, err = previous.Resumes(current)
+	if err != nil {
+		log.Fatalf("can not resume from %s, run without -resume to start over: %s", checkpointFile, err)
+	}
+	if row == previous.Rows() {
+		log.Infof("%s says the run already finished, nothing to resume", checkpointFile)
+		os.Exit(0)
+	}
+
+	current.RowsDone, current.NewFiles = row, previous.NewFiles
+	log.Infof("Resuming at file %d of %d", row+1, current.Rows())
+	return true
+}
+
+// fileStates returns the size and mtime of every file by its path.
+func fileStates(files []path.Entry) map[string]imagedup.FileState {
+	var states = make(map[string]imagedup.FileState, len(files))
+	for _, file := range files {
+		states[file.AbsolutePath] = imagedup.FileState{Size: file.FileInfo.Size(), ModTime: file.FileInfo.ModTime()}
+	}
+	return states
+}
+
+// config is everything set on the command line.
+type config struct {
+	cli.ScanFlags
+	dirs                                  []string
+	filesFrom                             string
+	cacheFile, outputFile, checkpointFile string
+	linkedFile, errorFile                 string
+	againstDir, againstCache              string
+	threads, distanceThreshold, depth     int
+	dedupFilePairs, resume, incremental   bool
+}
+
+// parseFlags parses and validates CLI flags, exiting on --help/--version,
+// and returns the resolved configuration values.
+func parseFlags(g *cli.Globals, args []string) config {
+	var c config
+	var fs = flag.NewFlagSet("scan", flag.ExitOnError)
+	c.Register(fs, "-error-file")
+	fs.Func("dir", "directory (abs path), can be repeated", func(dir string) error {
+		c.dirs = append(c.dirs, dir)
+		return nil
+	})
+	fs.StringVar(&c.filesFrom, "files-from", "", "file listing the images to dedup, one per line or NUL separated like find -print0, - reads stdin. can be combined with -dir")
+	fs.StringVar(&c.cacheFile, "cache-file", "cache.json", "json file to store the image hashes which be different for different input dirs")
+	fs.StringVar(&c.outputFile, "output-file", "delete.json", "json file to store the duplicate pairs, it will be deleted and recreated unless -resume is given")
+	fs.StringVar(&c.checkpointFile, "checkpoint-file", "", "json file to record how far the run got, defaults to <output-file>-checkpoint.json")
+	fs.StringVar(&c.linkedFile, "linked-file", "", "json file to list the paths that are hardlinks or symlinks to the same file, they are already linked rather than duplicates. defaults to <output-file>-linked.json")
+	fs.StringVar(&c.errorFile, "error-file", "", "json file to list the paths that failed and why, defaults to <output-file>-errors.json")
+	fs.BoolVar(&c.resume, "resume", false, "continue an interrupted run from its checkpoint and append to its output file, the files and flags must be the same")
+	fs.IntVar(&c.threads, "threads", 1, "number of threads to use, >1 only useful when rebuilding the cache")
+	fs.IntVar(&c.depth, "depth", 2, "how far down the directory tree to search for files")
+	fs.IntVar(&c.distanceThreshold, "distance", 10, "max distance for images to be considered the same")
+	fs.BoolVar(&c.dedupFilePairs, "dedup-file-pairs", false, "dedup file pairs e.g. if a&b have been compared then dont comprare b&a as it will have the same result. doing this will reduce the time to diff but will also require more memory.")
+	fs.BoolVar(&c.incremental, "incremental", false, "only compare files that are not in the last run that finished, see -checkpoint-file, or changed since, against every file and each other. the output file only gets the new duplicates")
+	fs.StringVar(&c.againstDir, "against", "", "reference library: only compare the files in -dir to the images in this dir, never to each other. reference images are never proposed for deletion")
+	fs.StringVar(&c.againstCache, "against-cache", "", "json file to store the hashes of the -against images, without -against every image in it is the reference library. defaults to -cache-file")
+	g.Parse(fs, args)
+
+	if len(c.dirs) == 0 && c.filesFrom == "" {
+		log.Fatal("nothing to dedup, use -dir or -files-from")
+	}
+	for _, dir := range c.dirs {
+		if _, err := os.Stat(strings.TrimSpace(dir)); err != nil {
+			log.Fatalf("directory %s is not valid, err :%s \n", dir, err.Error())
+		}
+	}
+	if c.againstDir != "" {
+		if _, err := os.Stat(strings.TrimSpace(c.againstDir)); err != nil {
+			log.Fatalf("directory %s is not valid, err :%s \n", c.againstDir, err.Error())
+		}
+	}
+	if c.againstCache != "" && filepath.Ext(c.againstCache) != ".json" {
+		log.Fatal("against cache file must have extension .json")
+	}
+	if c.incremental && c.against() {
+		log.Fatal("-incremental and -against can not be used together")
+	}
+	if c.threads <= 0 || c.threads > runtime.GOMAXPROCS(0) {
+		c.threads = 1
+	}
+	if filepath.Ext(c.cacheFile) != ".json" {
+		log.Fatal("cache file must have extension .json")
+	}
+	if filepath.Ext(c.outputFile) != ".json" {
+		log.Fatal("output file must have extension .json")
+	}
+	if c.checkpointFile == "" {
+		c.checkpointFile = strings.TrimSuffix(c.outputFile, ".json") + "-checkpoint.json"
+	}
+	if c.linkedFile == "" {
+		c.linkedFile = strings.TrimSuffix(c.outputFile, ".json") + "-linked.json"
+	}
+	if c.errorFile == "" {
+		c.errorFile = strings.TrimSuffix(c.outputFile, ".json") + "-errors.json"
+	}
+	return c
+}
+
+// against returns true when the files are compared to a reference library.
+func (c config) against() bool {
+	return c.againstDir != "" || c.againstCache != ""
+}
+
+// collectResults drains the result and error channels, logging each entry and recording the errors in errs,
+// until both are closed, a shutdown signal is received or errs says to stop. checkpoint is called every
+// checkpointInterval. It returns the error that stopped the run.
+func collectResults(results chan hash.DiffResult, errors chan error, rl *logger.DeleteLogger, id *imagedup.ImageDup, errs *runerr.Collector, gracefulShutdown chan os.Signal, checkpoint func()) error {
+	var ticker = time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+CollectionLoop:
+	for results != nil || errors != nil {
+		select {
+		case <-gracefulShutdown:
+			break CollectionLoop
+		default:
+			select {
+			case result, open := <-results:
+				if !open {
+					results = nil
+					continue
+				}
+				if err := rl.LogResult(result); err != nil {
+					// not handled, the checkpoint stays before it
+					if err := errs.Record(runerr.New(runerr.StageLog, result.One, err)); err != nil {
+						return err
+					}
+					continue
+				}
+				id.Handled(result)
+			case err, open := <-errors:
+				if !open {
+					errors = nil
+					continue
+				}
+				if stop := errs.Record(err); stop != nil {
+					// not handled, the checkpoint stays before the pair so -resume tries it again
+					return stop
+				}
+				id.HandledError(err)
+			case <-ticker.C:
+				checkpoint()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+// Package scandirs is the scan-dirs command, once uniqdirs: it dedups within every dir on its own, or finds
+// dirs that are near copies of each other.
+package scandirs
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/cli"
+	"github.com/kmulvey/imagedup/v2/internal/app/dirsim"
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
+	"github.com/kmulvey/imagedup/v2/internal/app/manifest"
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/kmulvey/path"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Command is imagedup scan-dirs.
+var Command = cli.Command{
+	Name:    "scan-dirs",
+	Summary: "dedup within every dir on its own, or find dirs that are near copies of each other with -similar-dirs",
+	Run:     run,
+}
+
+// run parses the flags of scan-dirs and runs it.
+func run(g *cli.Globals, args []string) {
+	var start = time.Now()
+
+	var ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var c = parseFlags(g, args)
+	g.StartMetrics()
+
+	cli.HandleErr("create output dir", os.MkdirAll(c.outputDir, 0750))
+	files, err := manifest.Open(c.outputDir)
+	cli.HandleErr("open manifest", err)
+
+	// list all the dirs
+	var errs = runerr.NewCollector(c.OnError)
+	var errorFile = filepath.Join(c.outputDir, runerr.ReportFileName)
+	previousErrors, err := runerr.Previous(errorFile)
+	cli.HandleErr("read error report", err)
+	var sources = c.Sources(c.depth, c.rootDir)
+	sources.OnError = errs.Record
+	dirNames, skipped, err := sources.ListDirs()
+	if err != nil {
+		cli.WriteErrors(errorFile, errs)
+	}
+	cli.HandleErr("listFiles", err)
+	log.Infof("Found %d dirs", len(dirNames))
+
+	var linked = make(filelist.Links)
+	var linkedFile = filepath.Join(c.outputDir, filelist.LinkReportFileName)
+	if c.similarDirs {
+		var reportFile, err = findSimilarDirs(ctx, dirNames, files, c, errs, skipped, linked)
+		cli.WriteLinked(linkedFile, linked)
+		cli.WriteErrors(errorFile, errs)
+		switch {
+		case ctx.Err() != nil:
+			log.Fatal("interrupted before every dir was hashed, the hashes so far are cached, run the same command again to finish")
+		case err != nil:
+			log.Fatalf("Stopped at the first error as -on-error is fail-fast, the hashes so far are cached, run the same command again to finish: %s", err)
+		}
+		log.Infof("Total time taken: %s, paths skipped: %s, already linked: %d, errors: %d, review the folders with: imagedup verify -dirs %s", time.Since(start), skipped, linked.Paths(), errs.Len(), reportFile)
+		return
+	}
+
+	err = processDirs(ctx, dirNames, files, c, errs, previousErrors, skipped, linked)
+	cli.WriteLinked(linkedFile, linked)
+	cli.WriteErrors(errorFile, errs)
+	switch {
+	case ctx.Err() != nil:
+		log.Infof("Interrupted after %s, run the same command again to continue with the dirs that were not finished", time.Since(start))
+		return
+	case err != nil:
+		log.Fatalf("Stopped at the first error as -on-error is fail-fast, run the same command again to continue with the dirs that were not finished: %s", err)
+	}
+
+	log.Infof("Total time taken: %s, paths skipped: %s, already linked: %d, errors: %d, review the duplicates with: imagedup verify -manifest %s", time.Since(start), skipped, linked.Paths(), errs.Len(), files.FileName)
+}
+
+// config is everything set on the command line.
+type config struct {
+	cli.ScanFlags
+	rootDir, outputDir                            string
+	dirWorkers, threads, distanceThreshold, depth int
+	dirSimilarity                                 float64
+	dedupFilePairs, similarDirs                   bool
+}
+
+// parseFlags parses CLI flags, handles --help/--version, validates inputs and
+// returns the resolved configuration values.
+func parseFlags(g *cli.Globals, args []string) config {
+	var c config
+	var fs = flag.NewFlagSet("scan-dirs", flag.ExitOnError)
+	c.Register(fs, runerr.ReportFileName+" in the output dir")
+	fs.StringVar(&c.rootDir, "dir", "", "directory (abs path)")
+	fs.StringVar(&c.outputDir, "output-dir", ".", "directory to write the cache and delete log of each dir to, along with "+manifest.FileName+" which lists them for imagedup verify -manifest")
+	fs.IntVar(&c.dirWorkers, "dir-workers", 1, "number of dirs to dedup at the same time, dir-workers * threads is capped at the number of CPUs")
+	fs.IntVar(&c.threads, "threads", 1, "number of threads to use for each dir, >1 only useful when rebuilding the cache")
+	fs.IntVar(&c.depth, "depth", 2, "how far down the directory tree to search for files")
+	fs.IntVar(&c.distanceThreshold, "distance", 10, "max distance for images to be considered the same")
+	fs.BoolVar(&c.dedupFilePairs, "dedup-file-pairs", false, "dedup file pairs e.g. if a&b have been compared then dont comprare b&a as it will have the same result. doing this will reduce the time to diff but will also require more memory.")
+	fs.BoolVar(&c.similarDirs, "similar-dirs", false, "instead of deduping inside each dir, find dirs that are near copies of each other and write them to "+dirsim.ReportFileName+" in the output dir for imagedup verify -dirs")
+	fs.Float64Var(&c.dirSimilarity, "dir-similarity", 0.8, "with -similar-dirs, the share of images two dirs must have in common (matched / all distinct images) to be reported")
+	g.Parse(fs, args)
+
+	if _, err := os.Stat(strings.TrimSpace(c.rootDir)); err != nil {
+		log.Fatalf("directory %s is not valid, err :%s \n", c.rootDir, err.Error())
+	}
+	if c.dirSimilarity <= 0 || c.dirSimilarity > 1 {
+		log.Fatalf("-dir-similarity must be greater than 0 and at most 1, got %g", c.dirSimilarity)
+	}
+	if c.threads <= 0 || c.threads > runtime.GOMAXPROCS(0) {
+		c.threads = 1
+	}
+	// every thread hashes one file at a time so capping the threads caps both CPU and open files
+	c.dirWorkers = min(max(c.dirWorkers, 1), runtime.GOMAXPROCS(0))
+	if c.dirWorkers*c.threads > runtime.GOMAXPROCS(0) {
+		c.threads = max(runtime.GOMAXPROCS(0)/c.dirWorkers, 1)
+		log.Warnf("%d dir workers would use more than %d CPUs, using %d threads per dir", c.dirWorkers, runtime.GOMAXPROCS(0), c.threads)
+	}
+	return c
+}
+
+// processDirs deduplicates the discovered directories, dirWorkers at a time. The manifest is
+// saved after every dir with the fingerprint of its files, so a run that was interrupted skips
+// the dirs that were finished and have not changed since, the errors previousErrors has for them are kept in errs.
+// The paths left out of each dir are added to skipped, the ones that are links to a file of the dir to linked. A dir
+// that fails is recorded in errs and left out of the manifest, it returns the error that stopped the run when errs says to stop.
+func processDirs(ctx context.Context, dirNames []string, files *manifest.Manifest, c config, errs *runerr.Collector, previousErrors *runerr.Report, skipped filelist.Skipped, linked filelist.Links) error {
+	var run, stop = context.WithCancelCause(ctx)
+	defer stop(nil)
+	var dirs = make(chan string)
+	var manifestLock sync.Mutex
+	var wg sync.WaitGroup
+
+	for worker := range c.dirWorkers {
+		// every instance registers the same metric names, the worker label tells them apart
+		var prom = metrics.Options{Namespace: "imagedup", ConstLabels: prometheus.Labels{"worker": strconv.Itoa(worker)}}
+
+		wg.Go(func() {
+			for dir := range dirs {
+				var listing, fingerprint, err = listImages(dir, c, errs)
+				if err != nil {
+					stop(err)
+					return
+				}
+				var dirSkipped = listing.Skipped
+
+				manifestLock.Lock()
+				skipped.Add(dirSkipped)
+				linked.Add(listing.Linked)
+				var unchanged = files.Done(dir, fingerprint)
+				if !unchanged && files.Forget(dir) {
+					cli.HandleErr("write manifest", files.Write())
+				}
+				manifestLock.Unlock()
+				if unchanged {
+					log.Infof("Skipping %s, unchanged since it was deduped", dir)
+					// its images that could not be hashed are not tried again, the dir is listed again
+					errs.Carry(previousErrors, func(entry runerr.Entry) bool {
+						return entry.Stage != runerr.StageList && strings.HasPrefix(entry.Path, dir+string(filepath.Separator))
+					})
+					continue
+				}
+
+				log.Infof("Starting %s", dir)
+				var entry = files.Files(dir)
+				deduped, err := dedupDir(run, dir, listing.Files, entry, prom, c, errs, dirSkipped)
+				manifestLock.Lock()
+				skipped.Add(dirSkipped)
+				manifestLock.Unlock()
+				if err != nil {
+					stop(err)
+					return
+				}
+				if !deduped {
+					continue // failed, it is in the error report and done again next time
+				}
+
+				if _, err := os.Stat(entry.DeleteLog); err != nil {
+					entry.DeleteLog = ""
+				}
+				if _, err := os.Stat(entry.Cache); err != nil {
+					continue // skipped, too few files
+				}
+
+				entry.Fingerprint = fingerprint
+				manifestLock.Lock()
+				files.Set(entry)
+				cli.HandleErr("write manifest", files.Write())
+				manifestLock.Unlock()
+			}
+		})
+	}
+
+feed:
+	for _, dir := range dirNames {
+		select {
+		case dirs <- dir:
+		case <-run.Done():
+			break feed
+		}
+	}
+	close(dirs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return context.Cause(run)
+}
+
+// listImages lists the images in dir and returns them with the fingerprint of the dir, paths that can not be
+// read are recorded in errs. The size and dimension limits are part of the fingerprint as they are applied later,
+// with the cache of the dir.
+func listImages(dir string, c config, errs *runerr.Collector) (filelist.Listing, string, error) {
+	var sources = c.Sources(c.depth, dir)
+	sources.OnError = errs.Record
+	var listing, err = sources.List()
+	if err != nil {
+		return filelist.Listing{}, "", err
+	}
+	cli.WarnMismatched(listing)
+
+	var files = listing.Files
+	var states = make([]manifest.FileState, len(files), len(files)+1)
+	for i, file := range files {
+		states[i] = manifest.FileState{Path: file.AbsolutePath, Size: file.FileInfo.Size(), ModTime: file.FileInfo.ModTime()}
+	}
+	if c.Filter != (filelist.Filter{}) {
+		states = append(states, manifest.FileState{Path: "filter:" + c.Filter.String()})
+	}
+	return listing, manifest.Fingerprint(c.distanceThreshold, states), nil
+}
+
+// dedupDir dedups the files of dir and returns true when it is done. A dir whose cache or delete log fails is
+// recorded in errs and left for the next run, the error is the one that stops the run: the shutdown signal or the first failure when
+// errs says to stop. Files outside of the size and dimension limits are added to skipped.
+func dedupDir(shutdown context.Context, dir string, files []path.Entry, entry manifest.Entry, prom metrics.Options, c config, errs *runerr.Collector, skipped filelist.Skipped) (bool, error) {
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	log.Infof("Found %d files in %s", len(files), dir)
+	if len(files) < 2 {
+		log.Infof("Skipping %s because there are only %d files", dir, len(files))
+		return true, nil
+	}
+
+	id, err := imagedup.NewImageDup(prom, entry.Cache, c.threads, len(files), c.distanceThreshold, c.dedupFilePairs)
+	if err != nil {
+		return false, errs.Record(runerr.New(runerr.StageCache, entry.Cache, err))
+	}
+	cli.DropChanged(id.HashCache, files)
+
+	files = c.Filter.Apply(files, id.HashCache.Dimensions, skipped)
+	var fileNames = path.OnlyNames(files)
+	if len(files) < 2 {
+		log.Infof("Skipping %s because there are only %d files within the size and dimension limits", dir, len(files))
+		cli.HandleErr("shut down", id.Shutdown())
+		return true, nil
+	}
+
+	// start er up
+	resultsLogger, err := logger.NewDeleteLogger(entry.DeleteLog)
+	if err != nil {
+		cli.HandleErr("shut down", id.Shutdown())
+		return false, errs.Record(runerr.New(runerr.StageLog, entry.DeleteLog, err))
+	}
+
+	var results, errors = id.Run(ctx, fileNames)
+
+	// wait for all diff workers to finish, a shutdown signal or an error that stops the run,
+	// whichever comes first. the hashes so far are cached either way
+	var done = true
+	var stopped error
+Collect:
+	for results != nil || errors != nil {
+		select {
+		case <-shutdown.Done():
+			done, stopped = false, shutdown.Err()
+			break Collect
+		default:
+			select {
+			case result, open := <-results:
+				if !open {
+					results = nil
+					continue
+				}
+				if err := resultsLogger.LogResult(result); err != nil {
+					done = false // the result is lost, the dir has to be done again
+					if stopped = errs.Record(runerr.New(runerr.StageLog, result.One, err)); stopped != nil {
+						break Collect
+					}
+				}
+
+			case err, open := <-errors:
+				if !open {
+					errors = nil
+					continue
+				}
+				// the image is in the error report, the dir is still done as a fixed image changes its fingerprint
+				if stopped = errs.Record(err); stopped != nil {
+					break Collect
+				}
+			}
+		}
+	}
+
+	// shut everything down
+	cancel()
+	if err := id.Shutdown(); err != nil {
+		log.Fatal("error shutting down", err)
+	}
+	if err := resultsLogger.Close(); err != nil {
+		log.Error(err)
+	}
+	if resultsLogger.Empty() {
+		// no duplicates, the manifest has no delete log for the dir
+		cli.HandleErr("remove log file", os.Remove(entry.DeleteLog))
+	}
+
+	return done, stopped
+}
@@ -0,0 +1,147 @@
+package scandirs
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/cli"
+	"github.com/kmulvey/imagedup/v2/internal/app/dirsim"
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
+	"github.com/kmulvey/imagedup/v2/internal/app/manifest"
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/path"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// findSimilarDirs hashes the images directly inside every dir, dirWorkers at a time, and writes the
+// dirs that are near copies of each other to the report in the output dir. The hashes go to the same
+// cache files a normal run uses so neither mode has to hash a dir twice. It returns the report file,
+// the paths left out of each dir are added to skipped and the ones that are links to a listed file to linked.
+// Images that fail are recorded in errs and left out, the error is the one that stopped the run.
+func findSimilarDirs(ctx context.Context, dirNames []string, files *manifest.Manifest, c config, errs *runerr.Collector, skipped filelist.Skipped, linked filelist.Links) (string, error) {
+	// the dirs are listed together so an image that is hardlinked into two dirs only counts for the first,
+	// dirs of links to the same files are not copies of each other
+	var sources = c.Sources(1, dirNames...)
+	sources.OnError = errs.Record
+	var listing, err = sources.List()
+	if err != nil {
+		return "", err
+	}
+	cli.WarnMismatched(listing)
+	skipped.Add(listing.Skipped)
+	linked.Add(listing.Linked)
+
+	var images = make(map[string][]path.Entry, len(dirNames))
+	for _, file := range listing.Files {
+		var dir = filepath.Dir(file.AbsolutePath)
+		images[dir] = append(images[dir], file)
+	}
+
+	var run, stop = context.WithCancelCause(ctx)
+	defer stop(nil)
+	var dirs = make(chan string)
+	var folders = make([]dirsim.Folder, 0, len(dirNames))
+	var foldersLock sync.Mutex
+	var wg sync.WaitGroup
+
+	for worker := range c.dirWorkers {
+		var prom = metrics.Options{Namespace: "imagedup", ConstLabels: prometheus.Labels{"worker": strconv.Itoa(worker)}}
+
+		wg.Go(func() {
+			for dir := range dirs {
+				var folder, dirSkipped, ok, err = hashDir(run, dir, images[dir], files.Files(dir).Cache, prom, c, errs)
+				if err != nil {
+					stop(err)
+				}
+				foldersLock.Lock()
+				skipped.Add(dirSkipped)
+				if ok {
+					folders = append(folders, folder)
+				}
+				foldersLock.Unlock()
+			}
+		})
+	}
+
+feed:
+	for _, dir := range dirNames {
+		select {
+		case dirs <- dir:
+		case <-run.Done():
+			break feed
+		}
+	}
+	close(dirs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if run.Err() != nil {
+		return "", context.Cause(run)
+	}
+
+	var report = &dirsim.Report{
+		Created:   time.Now(),
+		Distance:  c.distanceThreshold,
+		Threshold: c.dirSimilarity,
+		Matches:   dirsim.Find(folders, c.distanceThreshold, c.dirSimilarity),
+	}
+	var reportFile, _ = filepath.Abs(filepath.Join(filepath.Dir(files.FileName), dirsim.ReportFileName))
+	if err := report.WriteJSON(reportFile); err != nil {
+		return "", err
+	}
+
+	log.Infof("Found %d pairs of similar dirs", len(report.Matches))
+	for _, match := range report.Matches {
+		log.Infof("%.0f%% similar: %s (%d images) and %s (%d images)", match.Score*100, match.A, match.AImages, match.B, match.BImages)
+	}
+	return reportFile, nil
+}
+
+// hashDir hashes the images directly inside dir, images in sub dirs belong to those dirs. It returns the images
+// outside of the size and dimension limits as skipped, ok is false when the dir has no images within them.
+// Images that can not be hashed are recorded in errs and left out, the error is the one that stops the run.
+func hashDir(ctx context.Context, dir string, images []path.Entry, cacheFile string, prom metrics.Options, c config, errs *runerr.Collector) (dirsim.Folder, filelist.Skipped, bool, error) {
+	var folder = dirsim.Folder{Path: dir}
+	var skipped = make(filelist.Skipped)
+
+	log.Infof("Found %d files in %s", len(images), dir)
+	if len(images) == 0 {
+		return folder, skipped, false, nil
+	}
+
+	cache, err := hash.NewCache(cacheFile, prom.With("cache", "files"), len(images))
+	if err != nil {
+		return folder, skipped, false, errs.Record(runerr.New(runerr.StageCache, cacheFile, err))
+	}
+	cli.DropChanged(cache, images)
+	images = c.Filter.Apply(images, cache.Dimensions, skipped)
+
+	var stopped error
+	for _, entry := range images {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var img, err = cache.GetHash(entry.AbsolutePath)
+		if err != nil {
+			if stopped = errs.Record(runerr.New(runerr.StageHash, entry.AbsolutePath, err)); stopped != nil {
+				break
+			}
+			continue
+		}
+		folder.Images = append(folder.Images, dirsim.Image{Path: entry.AbsolutePath, Hash: img.GetHash(), Size: entry.FileInfo.Size()})
+	}
+
+	if err := cache.Persist(); err != nil && stopped == nil {
+		stopped = errs.Record(runerr.New(runerr.StageCache, cacheFile, err))
+	}
+	return folder, skipped, len(folder.Images) > 0, stopped
+}
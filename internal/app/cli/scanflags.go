@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/path"
+	log "github.com/sirupsen/logrus"
+)
+
+// ScanFlags are the flags of the commands that list and hash images: which images to pick and what to do
+// about the ones that fail.
+type ScanFlags struct {
+	Excludes []string
+	Formats  filelist.Formats
+	Sniff    bool
+	Symlinks filelist.SymlinkPolicy
+	Filter   filelist.Filter
+	OnError  runerr.Policy
+}
+
+// Register sets the defaults and adds the flags to fs, errorReport says where the errors are written to.
+func (s *ScanFlags) Register(fs *flag.FlagSet, errorReport string) {
+	s.Formats = filelist.DefaultFormats
+	fs.Func("exclude", "gitignore style pattern of files and dirs to skip e.g. @eaDir/ or *.lrprev, can be repeated. "+filelist.IgnoreFileName+" files in the dirs are honored too", func(pattern string) error {
+		if _, err := filelist.ParsePattern(pattern, "."); err != nil {
+			return err
+		}
+		s.Excludes = append(s.Excludes, pattern)
+		return nil
+	})
+	fs.Func("on-error", "what to do about a file or dir that can not be read or hashed: continue without it, or fail-fast to stop the run after saving the progress. the errors are written to "+errorReport+". default continue", func(policy string) (err error) {
+		s.OnError, err = runerr.ParsePolicy(policy)
+		return err
+	})
+	fs.Func("formats", "comma separated image formats to dedup: jpeg, png and gif, default "+filelist.DefaultFormats.String(), func(list string) (err error) {
+		s.Formats, err = filelist.ParseFormats(list)
+		return err
+	})
+	fs.BoolVar(&s.Sniff, "sniff", false, "pick images by their first bytes instead of their extension, finds images without an extension and reports the ones named like another format")
+	fs.Func("symlinks", "follow or skip symlinks to files and dirs, default follow", func(policy string) (err error) {
+		s.Symlinks, err = filelist.ParseSymlinkPolicy(policy)
+		return err
+	})
+	fs.Func("min-size", "skip files smaller than this e.g. 20KB", func(size string) (err error) {
+		s.Filter.MinSize, err = filelist.ParseBytes(size)
+		return err
+	})
+	fs.Func("max-size", "skip files larger than this e.g. 50MB", func(size string) (err error) {
+		s.Filter.MaxSize, err = filelist.ParseBytes(size)
+		return err
+	})
+	fs.Func("min-dimensions", "skip images narrower or shorter than WIDTHxHEIGHT e.g. 128x128, icons and avatars hash alike. either may be 0", func(dimensions string) (err error) {
+		s.Filter.MinWidth, s.Filter.MinHeight, err = filelist.ParseDimensions(dimensions)
+		return err
+	})
+	fs.Func("max-dimensions", "skip images wider or taller than WIDTHxHEIGHT, either may be 0", func(dimensions string) (err error) {
+		s.Filter.MaxWidth, s.Filter.MaxHeight, err = filelist.ParseDimensions(dimensions)
+		return err
+	})
+}
+
+// Sources returns where to look for images in dirs, depth levels down.
+func (s ScanFlags) Sources(depth int, dirs ...string) filelist.Sources {
+	var sources = filelist.Sources{Dirs: dirs, Depth: depth, Images: s.Formats.Regex(), Exclude: s.Excludes, Symlinks: s.Symlinks}
+	if s.Sniff {
+		sources.Sniff = s.Formats
+	}
+	return sources
+}
+
+// WarnMismatched logs the images whose extension belongs to another format.
+func WarnMismatched(listing filelist.Listing) {
+	for _, mismatch := range listing.Mismatched {
+		log.Warn(mismatch)
+	}
+}
+
+// DropChanged drops the files that changed since they were hashed from the cache, so they are hashed again.
+func DropChanged(cache *hash.Cache, files []path.Entry) {
+	for _, file := range files {
+		cache.Check(file.AbsolutePath, file.FileInfo.Size(), file.FileInfo.ModTime())
+	}
+}
+
+// WriteErrors writes the errors of the run to the error report, the report of an earlier run is removed
+// when there are none.
+func WriteErrors(errorFile string, errs *runerr.Collector) {
+	if err := errs.Write(errorFile); err != nil {
+		log.Error(err)
+		return
+	}
+	if errs.Len() > 0 {
+		log.Warnf("%d errors, see %s", errs.Len(), errorFile)
+	}
+}
+
+// WriteLinked writes the paths that are the same file as a listed one to the link report, they are never
+// compared so they are not in a delete log. The report of an earlier run is removed when there are none.
+func WriteLinked(linkedFile string, linked filelist.Links) {
+	if len(linked) == 0 {
+		if err := os.Remove(linkedFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error(err)
+		}
+		return
+	}
+	HandleErr("write link report", linked.Report().WriteJSON(linkedFile))
+	log.Infof("%d paths are hardlinks or symlinks to %d files that are listed once, see %s", linked.Paths(), len(linked), linkedFile)
+}
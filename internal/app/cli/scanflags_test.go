@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
+	"github.com/kmulvey/path"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropChanged(t *testing.T) {
+	t.Parallel()
+
+	var dir = t.TempDir()
+	var entry = func(name string) path.Entry {
+		var fileName = filepath.Join(dir, name)
+		content, err := os.ReadFile(filepath.Join("..", "imagedup", "testimages", name))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(fileName, content, 0600))
+		info, err := os.Stat(fileName)
+		assert.NoError(t, err)
+		return path.Entry{AbsolutePath: fileName, FileInfo: info}
+	}
+	var same, changed = entry("iceland.jpg"), entry("trees.jpg")
+
+	var cache, err = hash.NewCache(filepath.Join(dir, "cache.json"), metrics.Options{Registerer: prometheus.NewRegistry()}, 2)
+	assert.NoError(t, err)
+	for _, file := range []path.Entry{same, changed} {
+		_, err = cache.GetHash(file.AbsolutePath)
+		assert.NoError(t, err)
+	}
+
+	// touched after it was hashed
+	assert.NoError(t, os.Chtimes(changed.AbsolutePath, time.Now(), changed.FileInfo.ModTime().Add(time.Hour)))
+	info, err := os.Stat(changed.AbsolutePath)
+	assert.NoError(t, err)
+	changed.FileInfo = info
+
+	DropChanged(cache, []path.Entry{same, changed})
+	assert.Equal(t, []string{same.AbsolutePath}, cache.Files())
+}
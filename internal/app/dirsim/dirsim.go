@@ -0,0 +1,260 @@
+// Package dirsim finds folders that are near copies of each other, e.g. Vacation/ and Vacation (resized)/,
+// by scoring every pair of folders on the share of their images that perceptually match.
+package dirsim
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// Image is a hashed image in a folder.
+type Image struct {
+	Path string
+	Hash uint64
+	Size int64
+}
+
+// Folder is the hashed images of a single dir.
+type Folder struct {
+	Path   string
+	Images []Image
+}
+
+// Bytes is the total size of the images in the folder.
+func (f Folder) Bytes() int64 {
+	var total int64
+	for _, img := range f.Images {
+		total += img.Size
+	}
+	return total
+}
+
+// Match is a pair of folders that are near copies. Pairs has one entry per matched image with the
+// image from A as Big and the one from B as Small, swap them if B is the folder being kept.
+type Match struct {
+	A       string               `json:"a"`
+	B       string               `json:"b"`
+	AImages int                  `json:"a_images"`
+	BImages int                  `json:"b_images"`
+	ABytes  int64                `json:"a_bytes"`
+	BBytes  int64                `json:"b_bytes"`
+	Score   float64              `json:"score"`
+	Pairs   []logger.DeleteEntry `json:"pairs"`
+}
+
+// Report is every folder match found in a run.
+type Report struct {
+	Created   time.Time `json:"created"`
+	Distance  int       `json:"distance"`
+	Threshold float64   `json:"threshold"`
+	Matches   []Match   `json:"matches"`
+}
+
+// Find scores every pair of folders that could reach the threshold and returns the ones that do, best first.
+// Two images match when their hashes are within distance, each image is matched at most once and the
+// score is matched / (a + b - matched), the jaccard index of the two folders treating matches as equal.
+func Find(folders []Folder, distance int, threshold float64) []Match {
+	var matches []Match
+
+	for _, candidate := range candidates(folders, distance, threshold) {
+		var match = Score(folders[candidate[0]], folders[candidate[1]], distance)
+		if match.Score >= threshold {
+			matches = append(matches, match)
+		}
+	}
+
+	slices.SortStableFunc(matches, func(x, y Match) int {
+		return cmp.Or(cmp.Compare(y.Score, x.Score), cmp.Compare(x.A, y.A), cmp.Compare(x.B, y.B))
+	})
+	return matches
+}
+
+// Score matches the images of two folders, greedily pairing each image of a with its closest unused image in b.
+func Score(a, b Folder, distance int) Match {
+	var match = Match{A: a.Path, B: b.Path, AImages: len(a.Images), BImages: len(b.Images), ABytes: a.Bytes(), BBytes: b.Bytes()}
+	var used = make([]bool, len(b.Images))
+
+	for _, imgA := range a.Images {
+		var best, bestDistance = -1, distance + 1
+		for j, imgB := range b.Images {
+			if used[j] {
+				continue
+			}
+			if d := bits.OnesCount64(imgA.Hash ^ imgB.Hash); d < bestDistance {
+				best, bestDistance = j, d
+			}
+		}
+		if best < 0 {
+			continue
+		}
+
+		used[best] = true
+		var imgB = b.Images[best]
+		match.Pairs = append(match.Pairs, logger.DeleteEntry{
+			Big:        imgA.Path,
+			Small:      imgB.Path,
+			Distance:   bestDistance,
+			KeepReason: "folder duplicate",
+			BigInfo:    logger.NewFileSnapshot(imgA.Path, imgA.Hash),
+			SmallInfo:  logger.NewFileSnapshot(imgB.Path, imgB.Hash),
+		})
+	}
+
+	var union = len(a.Images) + len(b.Images) - len(match.Pairs)
+	if union > 0 {
+		match.Score = float64(len(match.Pairs)) / float64(union)
+	}
+	return match
+}
+
+// candidates returns the index pairs of folders that could reach the threshold. Each hash is split into at most 4
+// bands, two hashes within distance of each other differ in at most distance/bands bits in one of them, so the
+// images are looked up by every value that close to each of their bands and the hits are checked against the
+// whole hash. A pair is only returned when enough images of the first folder have a match in the second for the
+// score to reach the threshold, unrelated folders that share an image or two by chance are never scored.
+func candidates(folders []Folder, distance int, threshold float64) [][2]int {
+	distance = max(distance, 0)
+	var numBands = min(distance+1, 4)
+	var width = 64 / numBands
+	var radius = distance / numBands
+
+	type indexed struct {
+		folder int
+		hash   uint64
+	}
+	var index = make(map[[2]uint64][]indexed) // band number and value -> images
+	for i, folder := range folders {
+		for _, img := range folder.Images {
+			for band := range numBands {
+				var key = [2]uint64{uint64(band), bandValue(img.Hash, band, width, numBands)}
+				index[key] = append(index[key], indexed{folder: i, hash: img.Hash})
+			}
+		}
+	}
+
+	var pairs [][2]int
+	for i, a := range folders {
+		var hits = make(map[int]int) // folder -> images of a with a match in it
+		for _, img := range a.Images {
+			var matched = make(map[int]bool)
+			for band := range numBands {
+				near(bandValue(img.Hash, band, width, numBands), 0, bandSize(band, width, numBands), radius, func(value uint64) {
+					for _, other := range index[[2]uint64{uint64(band), value}] {
+						if other.folder <= i || matched[other.folder] || bits.OnesCount64(img.Hash^other.hash) > distance {
+							continue
+						}
+						if !couldReach(len(a.Images), len(folders[other.folder].Images), len(a.Images), threshold) {
+							continue
+						}
+						matched[other.folder] = true
+						hits[other.folder]++
+					}
+				})
+			}
+		}
+
+		for j, count := range hits {
+			if couldReach(len(a.Images), len(folders[j].Images), count, threshold) {
+				pairs = append(pairs, [2]int{i, j})
+			}
+		}
+	}
+
+	slices.SortFunc(pairs, func(x, y [2]int) int {
+		return cmp.Or(cmp.Compare(x[0], y[0]), cmp.Compare(x[1], y[1]))
+	})
+	return pairs
+}
+
+// couldReach returns true when folders of a and b images could score threshold with at most matched matches,
+// the score is matched / (a + b - matched). Given the size of the smaller folder as matched it checks the ratio of
+// the folder sizes, even if every image of the smaller folder matched the score would be too low.
+func couldReach(a, b, matched int, threshold float64) bool {
+	matched = min(matched, a, b)
+	if matched == 0 {
+		return false
+	}
+	return float64(matched)/float64(a+b-matched) >= threshold
+}
+
+// near calls fn with value and every value of size bits that differs from it in at most radius bits from bit
+// from on.
+func near(value uint64, from, size, radius int, fn func(uint64)) {
+	fn(value)
+	if radius == 0 {
+		return
+	}
+	for bit := from; bit < size; bit++ {
+		near(value^(1<<bit), bit+1, size, radius-1, fn)
+	}
+}
+
+// bandSize returns the number of bits in a band, the last band also gets the bits left over when 64 does not
+// divide evenly.
+func bandSize(band, width, numBands int) int {
+	if band == numBands-1 {
+		return 64 - band*width
+	}
+	return width
+}
+
+// bandValue returns the bits of a band.
+func bandValue(hash uint64, band, width, numBands int) uint64 {
+	var size = bandSize(band, width, numBands)
+	if size >= 64 {
+		return hash
+	}
+	return (hash >> (band * width)) & (1<<size - 1)
+}
+
+// ReadReport reads a report written by WriteJSON.
+func ReadReport(fileName string) (*Report, error) {
+	// #nosec G304: fileName is given to us by the user.
+	var data, err = os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read folder report: %s, err: %w", fileName, err)
+	}
+
+	var report = new(Report)
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal folder report: %s, err: %w", fileName, err)
+	}
+	return report, nil
+}
+
+// WriteJSON saves the report as indented json.
+func (r *Report) WriteJSON(fileName string) error {
+	var data, err = json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal folder report, err: %w", err)
+	}
+	if err := os.WriteFile(fileName, data, 0600); err != nil {
+		return fmt.Errorf("unable to write folder report: %s, err: %w", fileName, err)
+	}
+	return nil
+}
+
+// ReportFileName is the name of the report inside the uniqdirs output dir.
+const ReportFileName = "similar-dirs.json"
+
+// Keep returns the pairs oriented so Big is in the kept folder and Small in the one being removed.
+func (m Match) Keep(dir string) []logger.DeleteEntry {
+	if dir != m.B {
+		return m.Pairs
+	}
+
+	var pairs = make([]logger.DeleteEntry, len(m.Pairs))
+	for i, pair := range m.Pairs {
+		pair.Big, pair.Small = pair.Small, pair.Big
+		pair.BigInfo, pair.SmallInfo = pair.SmallInfo, pair.BigInfo
+		pairs[i] = pair
+	}
+	return pairs
+}
@@ -0,0 +1,127 @@
+package dirsim
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func folder(path string, hashes ...uint64) Folder {
+	var f = Folder{Path: path}
+	for i, h := range hashes {
+		f.Images = append(f.Images, Image{Path: filepath.Join(path, string(rune('a'+i))+".jpg"), Hash: h, Size: 100})
+	}
+	return f
+}
+
+func TestScore(t *testing.T) {
+	t.Parallel()
+
+	var a = folder("/photos/vacation", 0x0, 0xff00, 0xffff0000, 0xf0f0f0f0f0f0f0f0)
+	var b = folder("/photos/vacation (resized)", 0x1, 0xff01, 0xffff0003, 0x0f0f0f0f0f0f0f0f) // last one is far from everything
+
+	var match = Score(a, b, 2)
+	assert.Len(t, match.Pairs, 3)
+	assert.InDelta(t, 3.0/5.0, match.Score, 0.0001)
+	assert.Equal(t, int64(400), match.ABytes)
+	assert.Equal(t, "/photos/vacation/a.jpg", match.Pairs[0].Big)
+	assert.Equal(t, "/photos/vacation (resized)/a.jpg", match.Pairs[0].Small)
+	assert.Equal(t, 2, match.Pairs[2].Distance)
+
+	// every image is matched at most once
+	match = Score(folder("/a", 0x0, 0x0, 0x0), folder("/b", 0x0), 0)
+	assert.Len(t, match.Pairs, 1)
+	assert.InDelta(t, 1.0/3.0, match.Score, 0.0001)
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+
+	var folders = []Folder{
+		folder("/photos/vacation", 0x1111, 0x2222, 0x3333, 0x4444),
+		folder("/photos/other", 0xffffffff00000000, 0xffff0000ffff0000),
+		folder("/photos/vacation (resized)", 0x1110, 0x2223, 0x3333, 0x4444),
+		folder("/photos/vacation partial", 0x1111, 0xaaaaaaaaaaaaaaaa),
+		folder("/photos/empty"),
+	}
+
+	var matches = Find(folders, 2, 0.8)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "/photos/vacation", matches[0].A)
+	assert.Equal(t, "/photos/vacation (resized)", matches[0].B)
+	assert.InDelta(t, 1.0, matches[0].Score, 0.0001)
+
+	matches = Find(folders, 2, 0.1)
+	assert.Len(t, matches, 3)
+	assert.InDelta(t, 1.0, matches[0].Score, 0.0001)
+}
+
+func TestCandidates(t *testing.T) {
+	t.Parallel()
+
+	// the hashes differ in 3 bits spread over the whole hash, at least one of the 4 bands is identical
+	var folders = []Folder{folder("/a", 0x8000000100000001), folder("/b", 0x0000000000000000), folder("/c", 0x5555555555555555)}
+	assert.Equal(t, [][2]int{{0, 1}}, candidates(folders, 3, 0))
+	assert.Empty(t, candidates(folders, 2, 0), "3 bits apart can not be within 2")
+
+	// 10 bits apart, 2 or 3 of them in each band
+	folders = []Folder{folder("/a", 0x0), folder("/b", 0x0003_0007_0003_0007)}
+	assert.Equal(t, [][2]int{{0, 1}}, candidates(folders, 10, 0))
+	assert.Empty(t, candidates(folders, 9, 0))
+
+	// one image in common can not make folders of 1 and 4 images score 0.5
+	folders = []Folder{folder("/a", 0x1), folder("/b", 0x1, 0x2, 0x3, 0x4)}
+	assert.Equal(t, [][2]int{{0, 1}}, candidates(folders, 0, 0.25))
+	assert.Empty(t, candidates(folders, 0, 0.5))
+}
+
+func TestCandidatesUnrelated(t *testing.T) {
+	t.Parallel()
+
+	// random hashes are rarely within the default distance of each other, the folders must not all be paired up
+	var random = rand.New(rand.NewPCG(1, 2))
+	var folders = make([]Folder, 500)
+	for i := range folders {
+		var hashes = make([]uint64, 20)
+		for j := range hashes {
+			hashes[j] = random.Uint64()
+		}
+		folders[i] = folder(fmt.Sprintf("/photos/%d", i), hashes...)
+	}
+	assert.Empty(t, candidates(folders, 10, 0.5))
+
+	// a copy of one of them is still found
+	folders = append(folders, Folder{Path: "/photos/copy", Images: folders[42].Images})
+	assert.Equal(t, [][2]int{{42, 500}}, candidates(folders, 10, 0.5))
+}
+
+func TestKeep(t *testing.T) {
+	t.Parallel()
+
+	var match = Score(folder("/a", 0x1), folder("/b", 0x1), 0)
+	assert.Equal(t, "/a/a.jpg", match.Keep("/a")[0].Big)
+
+	var pairs = match.Keep("/b")
+	assert.Equal(t, "/b/a.jpg", pairs[0].Big)
+	assert.Equal(t, "/a/a.jpg", pairs[0].Small)
+	assert.Equal(t, "/a/a.jpg", match.Pairs[0].Big, "the match must not change")
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	var fileName = filepath.Join(t.TempDir(), ReportFileName)
+	var report = &Report{Distance: 2, Threshold: 0.8, Matches: Find([]Folder{folder("/a", 0x1), folder("/b", 0x1)}, 2, 0.8)}
+	assert.NoError(t, report.WriteJSON(fileName))
+
+	var read, err = ReadReport(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, report.Matches[0].Pairs[0].Small, read.Matches[0].Pairs[0].Small)
+	assert.Equal(t, 0.8, read.Threshold)
+
+	_, err = ReadReport(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package filelist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseBytes parses a size such as 1500, 512KB or 1.5MB. Every unit is a power of 1024 to match FormatBytes.
+func ParseBytes(s string) (int64, error) {
+	var upper = strings.ToUpper(strings.TrimSpace(s))
+	var multiplier int64 = 1
+	for _, unit := range []struct {
+		suffixes   []string
+		multiplier int64
+	}{
+		{[]string{"GIB", "GB", "G"}, 1 << 30},
+		{[]string{"MIB", "MB", "M"}, 1 << 20},
+		{[]string{"KIB", "KB", "K"}, 1 << 10},
+		{[]string{"B"}, 1},
+	} {
+		var found bool
+		for _, suffix := range unit.suffixes {
+			if trimmed, ok := strings.CutSuffix(upper, suffix); ok {
+				upper, multiplier, found = strings.TrimSpace(trimmed), unit.multiplier, true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	var n, err = strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatBytes formats a byte count using binary units, e.g. 1.5 MiB.
+func FormatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	var div, exp = int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
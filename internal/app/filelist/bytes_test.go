@@ -0,0 +1,27 @@
+package filelist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBytes(t *testing.T) {
+	t.Parallel()
+
+	for s, expected := range map[string]int64{"1500": 1500, "1B": 1, "512KB": 512 << 10, "1.5MB": 3 << 19, "2 GiB": 2 << 30, "1m": 1 << 20} {
+		var n, err = ParseBytes(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, n, s)
+	}
+
+	var _, err = ParseBytes("-1")
+	assert.Error(t, err)
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "10 B", FormatBytes(10))
+	assert.Equal(t, "2.0 MiB", FormatBytes(2*1024*1024))
+}
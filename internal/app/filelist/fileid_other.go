@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package filelist
+
+import "os"
+
+// fileID is not known on this platform, hardlinks are not detected.
+func fileID(_ os.FileInfo) (string, bool) {
+	return "", false
+}
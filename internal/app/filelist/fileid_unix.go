@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package filelist
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of the file info, paths with the same one are the same file.
+func fileID(info os.FileInfo) (string, bool) {
+	var stat, ok = info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	//nolint:unconvert // Dev is not a uint64 on every platform
+	return fmt.Sprintf("%d:%d", uint64(stat.Dev), uint64(stat.Ino)), true
+}
@@ -0,0 +1,365 @@
+// Package filelist builds the list of images to dedup from any number of dirs and lists of files,
+// e.g. the output of find, so one run can cover several mounts.
+package filelist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/path"
+	log "github.com/sirupsen/logrus"
+)
+
+// SkipExcluded is the reason for paths left out by Exclude and ignore files, an excluded dir counts once.
+const SkipExcluded = "excluded"
+
+// Skipped are the paths that were left out of a listing by why they were left out. They are kept
+// rather than counted so listing overlapping dirs, as uniqdirs does, counts each path once.
+type Skipped map[string]map[string]bool
+
+// skip records that name was left out for reason.
+func (s Skipped) skip(reason, name string) {
+	if s[reason] == nil {
+		s[reason] = make(map[string]bool)
+	}
+	s[reason][name] = true
+}
+
+// Add adds the paths of other.
+func (s Skipped) Add(other Skipped) {
+	for reason, names := range other {
+		for name := range names {
+			s.skip(reason, name)
+		}
+	}
+}
+
+// Count returns how many paths were left out for reason.
+func (s Skipped) Count(reason string) int {
+	return len(s[reason])
+}
+
+// String summarizes the counts for the log, e.g. "12 excluded".
+func (s Skipped) String() string {
+	var parts []string
+	for _, reason := range slices.Sorted(maps.Keys(s)) {
+		parts = append(parts, fmt.Sprintf("%d %s", s.Count(reason), reason))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Sources are the places to collect images from.
+type Sources struct {
+	Dirs  []string
+	Depth int
+	// FilesFrom is a list of files separated by newlines, or by NUL if it contains any, e.g. find -print0.
+	FilesFrom io.Reader
+	// Images matches the names of the files to keep.
+	Images *regexp.Regexp
+	// Sniff, when set, picks the images by their first bytes instead of by Images and keeps the ones in
+	// these formats, whatever their extension. Images named like another format are in Mismatched.
+	Sniff Formats
+	// Exclude are gitignore style patterns, anchored ones are relative to each dir and to the
+	// current dir for FilesFrom. They win over the ignore files.
+	Exclude  []string
+	Symlinks SymlinkPolicy
+	// OnError gets a *runerr.Error for each dir that can not be read and each file that can not be stat'ed
+	// or sniffed. The path is left out when it returns nil, listing stops with its error otherwise. Without
+	// it files are left out with a warning and an unreadable dir stops the listing.
+	OnError func(error) error
+}
+
+// Listing is what Sources.List found.
+type Listing struct {
+	Files      []path.Entry
+	Skipped    Skipped
+	Linked     Links
+	Mismatched []Mismatch
+}
+
+// List returns every image in the dirs and the list, in the order they were found. A file that is
+// reached more than once, through the same path, a hardlink, a symlink or overlapping dirs, is only
+// listed the first time so it is never compared to itself, the other paths are in Linked. Files and
+// dirs matched by Exclude or an ignore file in their dir or any dir above it are skipped.
+func (s Sources) List() (Listing, error) {
+	var listing = Listing{Skipped: make(Skipped), Linked: make(Links)}
+	var listed = make(map[string]string) // identity -> the path it was listed as
+	var add = func(entry path.Entry) error {
+		if isImage, err := s.isImage(entry, &listing); !isImage {
+			return err
+		}
+		var id = identity(entry.AbsolutePath, entry.FileInfo)
+		if first, found := listed[id]; found {
+			listing.Linked.add(first, entry.AbsolutePath)
+			return nil
+		}
+		listed[id] = entry.AbsolutePath
+		listing.Files = append(listing.Files, entry)
+		return nil
+	}
+
+	var ignores = make(ignoreFiles)
+	for _, dir := range s.Dirs {
+		if err := s.walk(dir, ignores, listing.Skipped, add, nil); err != nil {
+			return Listing{}, err
+		}
+	}
+
+	if s.FilesFrom != nil {
+		var names, err = ReadNames(s.FilesFrom)
+		if err != nil {
+			return Listing{}, err
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return Listing{}, fmt.Errorf("unable to get current dir, err: %w", err)
+		}
+		excludes, err := ParsePatterns(cwd, s.Exclude...)
+		if err != nil {
+			return Listing{}, err
+		}
+
+		for _, name := range names {
+			if s.Sniff == nil && !s.Images.MatchString(name) {
+				continue
+			}
+			var entry, err = newEntry(name)
+			if err != nil {
+				if err := s.fail(name, err, false); err != nil {
+					return Listing{}, err
+				}
+				continue
+			}
+			if s.Symlinks == SymlinksSkip {
+				if info, err := os.Lstat(entry.AbsolutePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+					listing.Skipped.skip(SkipSymlink, entry.AbsolutePath)
+					continue
+				}
+			}
+			patterns, err := ignores.chain(filepath.Dir(entry.AbsolutePath))
+			if err != nil {
+				return Listing{}, err
+			}
+			if slices.Concat(patterns, excludes).ExcludedPath(entry.AbsolutePath) {
+				listing.Skipped.skip(SkipExcluded, entry.AbsolutePath)
+				continue
+			}
+			if err := add(entry); err != nil {
+				return Listing{}, err
+			}
+		}
+	}
+
+	return listing, nil
+}
+
+// isImage returns true when the file is an image to list, by its name or its first bytes. The error
+// is the one of OnError for a file that can not be sniffed.
+func (s Sources) isImage(entry path.Entry, listing *Listing) (bool, error) {
+	if s.Sniff == nil {
+		return s.Images.MatchString(filepath.Base(entry.AbsolutePath)), nil
+	}
+
+	var format, err = Sniff(entry.AbsolutePath)
+	if err != nil {
+		return false, s.fail(entry.AbsolutePath, err, false)
+	}
+	if format == "" {
+		return false, nil
+	}
+	if extension := formatOfExtension(entry.AbsolutePath); extension != "" && extension != format {
+		listing.Mismatched = append(listing.Mismatched, Mismatch{Path: entry.AbsolutePath, Extension: extension, Content: format})
+	}
+	if !slices.Contains(s.Sniff, format) {
+		listing.Skipped.skip(SkipFormat, entry.AbsolutePath)
+		return false, nil
+	}
+	return true, nil
+}
+
+// fail hands the error of a path to OnError. Without OnError the path is left out with a warning, unless
+// stop is true.
+func (s Sources) fail(name string, err error, stop bool) error {
+	switch {
+	case s.OnError != nil:
+		return s.OnError(runerr.New(runerr.StageList, name, err))
+	case stop:
+		return fmt.Errorf("unable to list: %s, err: %w", name, err)
+	}
+	log.Warnf("skipping %s, err: %s", name, err)
+	return nil
+}
+
+// ListDirs returns the dirs under each of the dirs, Depth levels down, leaving out the excluded ones.
+func (s Sources) ListDirs() ([]string, Skipped, error) {
+	var dirs []string
+	var skipped = make(Skipped)
+	var ignores = make(ignoreFiles)
+	for _, dir := range s.Dirs {
+		var onDir = func(entry path.Entry) error {
+			dirs = append(dirs, entry.AbsolutePath)
+			return nil
+		}
+		if err := s.walk(dir, ignores, skipped, nil, onDir); err != nil {
+			return nil, nil, err
+		}
+	}
+	return dirs, skipped, nil
+}
+
+// walk calls onFile for every file and onDir for every dir under root, either may be nil, and stops at the
+// first error they return. Symlinks are followed or skipped by the symlink policy.
+func (s Sources) walk(root string, ignores ignoreFiles, skipped Skipped, onFile, onDir func(path.Entry) error) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("unable to make path absolute: %s, err: %w", root, err)
+	}
+	excludes, err := ParsePatterns(root, s.Exclude...)
+	if err != nil {
+		return err
+	}
+
+	var visit func(dir string, level int) error
+	visit = func(dir string, level int) error {
+		var patterns, err = ignores.chain(dir)
+		if err != nil {
+			return err
+		}
+		patterns = slices.Concat(patterns, excludes)
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return s.fail(dir, err, true)
+		}
+		for _, e := range entries {
+			if e.Name() == IgnoreFileName {
+				continue
+			}
+			var name = filepath.Join(dir, e.Name())
+			if e.Type()&os.ModeSymlink != 0 && s.Symlinks == SymlinksSkip {
+				skipped.skip(SkipSymlink, name)
+				continue
+			}
+			var info, err = os.Stat(name)
+			if err != nil {
+				if err := s.fail(name, err, false); err != nil {
+					return err
+				}
+				continue
+			}
+			if patterns.Excluded(name, info.IsDir()) {
+				skipped.skip(SkipExcluded, name)
+				continue
+			}
+
+			switch {
+			case info.IsDir():
+				if onDir != nil {
+					if err := onDir(path.Entry{AbsolutePath: name, FileInfo: info}); err != nil {
+						return err
+					}
+				}
+				if level < s.Depth {
+					if err := visit(name, level+1); err != nil {
+						return err
+					}
+				}
+			case onFile != nil && info.Mode().IsRegular():
+				if err := onFile(path.Entry{AbsolutePath: name, FileInfo: info}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return visit(root, 1)
+}
+
+// ignoreFiles caches the patterns of the ignore files in a dir and every dir above it.
+type ignoreFiles map[string]Patterns
+
+// chain returns the patterns of the ignore files in dir and every dir above it, outermost first.
+func (ig ignoreFiles) chain(dir string) (Patterns, error) {
+	if patterns, ok := ig[dir]; ok {
+		return patterns, nil
+	}
+
+	var patterns Patterns
+	if parent := filepath.Dir(dir); parent != dir {
+		var err error
+		if patterns, err = ig.chain(parent); err != nil {
+			return nil, err
+		}
+	}
+	var local, err = LoadIgnoreFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	patterns = slices.Concat(patterns, local)
+	ig[dir] = patterns
+	return patterns, nil
+}
+
+// newEntry stats a file from a list. path.NewEntry is not used as it expands globs and trims spaces,
+// both of which are valid in file names.
+func newEntry(name string) (path.Entry, error) {
+	var abs, err = filepath.Abs(name)
+	if err != nil {
+		return path.Entry{}, fmt.Errorf("unable to make path absolute: %s, err: %w", name, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return path.Entry{}, fmt.Errorf("unable to stat file: %s, err: %w", abs, err)
+	}
+	if info.IsDir() {
+		return path.Entry{}, fmt.Errorf("%s is a dir, use -dir for dirs", abs)
+	}
+	return path.Entry{AbsolutePath: abs, FileInfo: info}, nil
+}
+
+// ReadNames reads a list of file names separated by newlines, or by NUL if there is a NUL anywhere in it.
+// Empty names are skipped.
+func ReadNames(r io.Reader) ([]string, error) {
+	var data, err = io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read list of files, err: %w", err)
+	}
+
+	var sep = []byte("\n")
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = []byte{0}
+	}
+
+	var names []string
+	for name := range bytes.SplitSeq(data, sep) {
+		name = bytes.TrimSuffix(name, []byte("\r"))
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// Open opens the list of files given on the command line, - is stdin.
+func Open(fileName string) (io.ReadCloser, error) {
+	if fileName == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	// #nosec G304: fileName is given to us by the user.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open list of files: %s, err: %w", fileName, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,173 @@
+package filelist
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
+	"github.com/kmulvey/path"
+	"github.com/stretchr/testify/assert"
+)
+
+var images = regexp.MustCompile(`\.jpg$`)
+
+func TestReadNames(t *testing.T) {
+	t.Parallel()
+
+	var names, err = ReadNames(strings.NewReader("a.jpg\r\nb c.jpg\n\nd.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.jpg", "b c.jpg", "d.jpg"}, names)
+
+	names, err = ReadNames(strings.NewReader("a.jpg\x00new\nline.jpg\x00"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.jpg", "new\nline.jpg"}, names)
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	var one, two = t.TempDir(), t.TempDir()
+	for _, name := range []string{filepath.Join(one, "a.jpg"), filepath.Join(one, "notes.txt"), filepath.Join(two, "b [1].jpg")} {
+		assert.NoError(t, os.WriteFile(name, []byte("x"), 0600))
+	}
+	assert.NoError(t, os.Symlink(filepath.Join(one, "a.jpg"), filepath.Join(two, "link.jpg")))
+
+	var list = strings.Join([]string{
+		filepath.Join(two, "b [1].jpg"),
+		filepath.Join(one, "a.jpg"), // already found in one
+		filepath.Join(one, "notes.txt"),
+		filepath.Join(two, "missing.jpg"),
+		two, // dirs are not files
+	}, "\n")
+
+	var listing, err = Sources{Dirs: []string{one, two, one}, Depth: 1, FilesFrom: strings.NewReader(list), Images: images}.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(one, "a.jpg"), filepath.Join(two, "b [1].jpg")}, path.OnlyNames(listing.Files),
+		"the symlink and the second listing of one point at a.jpg")
+	assert.Equal(t, Links{filepath.Join(one, "a.jpg"): {filepath.Join(two, "link.jpg")}}, listing.Linked)
+	assert.Equal(t, "none", listing.Skipped.String())
+
+	_, err = Sources{Dirs: []string{filepath.Join(one, "missing")}, Depth: 1, Images: images}.List()
+	assert.Error(t, err)
+}
+
+func TestListErrors(t *testing.T) {
+	t.Parallel()
+
+	var root = t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.jpg"), []byte("x"), 0600))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "gone.jpg"), filepath.Join(root, "dangling.jpg")))
+
+	var errs = runerr.NewCollector(runerr.Continue)
+	var sources = Sources{Dirs: []string{filepath.Join(root, "missing"), root}, Depth: 1, Images: images, OnError: errs.Record}
+	var listing, err = sources.List()
+	assert.NoError(t, err, "the paths that failed are left out")
+	assert.Equal(t, []string{filepath.Join(root, "a.jpg")}, path.OnlyNames(listing.Files))
+	var report = errs.Report()
+	assert.Len(t, report.Errors, 2)
+	assert.Equal(t, runerr.StageList, report.Errors[0].Stage)
+	assert.Equal(t, filepath.Join(root, "missing"), report.Errors[0].Path)
+	assert.Equal(t, filepath.Join(root, "dangling.jpg"), report.Errors[1].Path)
+
+	sources.OnError = runerr.NewCollector(runerr.FailFast).Record
+	_, err = sources.List()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	var failed *runerr.Error
+	assert.ErrorAs(t, err, &failed)
+	assert.Equal(t, filepath.Join(root, "missing"), failed.Path)
+}
+
+func TestListExclude(t *testing.T) {
+	t.Parallel()
+
+	var root = t.TempDir()
+	for _, name := range []string{"a.jpg", "@eaDir/a.jpg", "trip/b.jpg", "trip/.thumbnails/b.jpg", "trip/previews/c.jpg", "trip/previews/keep.jpg", "trip/d.jpg"} {
+		name = filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0750))
+		assert.NoError(t, os.WriteFile(name, []byte("x"), 0600))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(root, IgnoreFileName), []byte("# synology\n@eaDir/\n"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "trip", IgnoreFileName), []byte("previews/\n!keep.jpg\n"), 0600))
+
+	var sources = Sources{Dirs: []string{root}, Depth: 3, Images: images, Exclude: []string{".thumbnails", "/trip/d.jpg"}}
+	var listing, err = sources.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a.jpg"), filepath.Join(root, "trip", "b.jpg")}, path.OnlyNames(listing.Files),
+		"an excluded dir can not be re-included from inside it")
+	assert.Equal(t, 4, listing.Skipped.Count(SkipExcluded))
+
+	// the ignore files above a dir count when only the dir is listed
+	sources.Dirs = []string{filepath.Join(root, "@eaDir")}
+	listing, err = sources.List()
+	assert.NoError(t, err)
+	assert.Len(t, listing.Files, 1, "the dir itself was asked for")
+
+	sources.Dirs = nil
+	sources.FilesFrom = strings.NewReader(filepath.Join(root, "trip", "previews", "c.jpg") + "\n" + filepath.Join(root, "a.jpg"))
+	listing, err = sources.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a.jpg")}, path.OnlyNames(listing.Files))
+	assert.Equal(t, "1 excluded", listing.Skipped.String())
+
+	dirs, skipped, err := Sources{Dirs: []string{root}, Depth: 2, Exclude: []string{"trip/"}}.ListDirs()
+	assert.NoError(t, err)
+	assert.Empty(t, dirs)
+	assert.Equal(t, 2, skipped.Count(SkipExcluded))
+}
+
+func TestListLinks(t *testing.T) {
+	t.Parallel()
+
+	var root, farm = t.TempDir(), t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.jpg"), []byte("x"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "b.jpg"), []byte("x"), 0600))
+	assert.NoError(t, os.Link(filepath.Join(root, "a.jpg"), filepath.Join(root, "hardlink.jpg")))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "b.jpg"), filepath.Join(farm, "b.jpg")))
+	assert.NoError(t, os.Symlink(root, filepath.Join(farm, "library")))
+
+	var sources = Sources{Dirs: []string{root, farm}, Depth: 2, Images: images}
+	var listing, err = sources.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a.jpg"), filepath.Join(root, "b.jpg")}, path.OnlyNames(listing.Files))
+	assert.Equal(t, Links{
+		filepath.Join(root, "a.jpg"): {filepath.Join(root, "hardlink.jpg"), filepath.Join(farm, "library", "a.jpg"), filepath.Join(farm, "library", "hardlink.jpg")},
+		filepath.Join(root, "b.jpg"): {filepath.Join(farm, "b.jpg"), filepath.Join(farm, "library", "b.jpg")},
+	}, listing.Linked)
+	assert.Equal(t, 5, listing.Linked.Paths())
+
+	sources.Symlinks = SymlinksSkip
+	listing, err = sources.List()
+	assert.NoError(t, err)
+	assert.Len(t, listing.Files, 2)
+	assert.Equal(t, Links{filepath.Join(root, "a.jpg"): {filepath.Join(root, "hardlink.jpg")}}, listing.Linked)
+	assert.Equal(t, 2, listing.Skipped.Count(SkipSymlink))
+
+	// a file that is also in the reference library is not compared to it
+	listing.DropLinked([]path.Entry{listing.Files[0]})
+	assert.Equal(t, []string{filepath.Join(root, "b.jpg")}, path.OnlyNames(listing.Files))
+	listing.Files = append(listing.Files, path.Entry{AbsolutePath: filepath.Join(root, "hardlink.jpg"), FileInfo: mustStat(t, filepath.Join(root, "hardlink.jpg"))})
+	listing.DropLinked([]path.Entry{{AbsolutePath: filepath.Join(farm, "a.jpg"), FileInfo: mustStat(t, filepath.Join(root, "a.jpg"))}})
+	assert.Len(t, listing.Files, 1)
+	assert.Equal(t, []string{filepath.Join(root, "hardlink.jpg")}, listing.Linked[filepath.Join(farm, "a.jpg")])
+
+	var fileName = filepath.Join(t.TempDir(), "linked.json")
+	assert.NoError(t, listing.Linked.Report().WriteJSON(fileName))
+	report, err := ReadLinkReport(fileName)
+	assert.NoError(t, err)
+	assert.Len(t, report.Groups, 2)
+	assert.Equal(t, []string{filepath.Join(farm, "a.jpg"), filepath.Join(root, "hardlink.jpg")}, report.Groups[1].Paths)
+
+	_, err = ParseSymlinkPolicy("sometimes")
+	assert.ErrorIs(t, err, ErrUnknownSymlinkPolicy)
+}
+
+func mustStat(t *testing.T, name string) os.FileInfo {
+	t.Helper()
+
+	var info, err = os.Stat(name)
+	assert.NoError(t, err)
+	return info
+}
@@ -0,0 +1,137 @@
+package filelist
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmulvey/path"
+)
+
+// the reasons Filter skips a file.
+const (
+	SkipTooSmall      = "too small"
+	SkipTooLarge      = "too large"
+	SkipTooFewPixels  = "too few pixels"
+	SkipTooManyPixels = "too many pixels"
+)
+
+// ErrBadDimensions is returned for dimensions that are not WIDTHxHEIGHT.
+var ErrBadDimensions = errors.New("invalid dimensions")
+
+// Filter leaves out images by file size and pixel dimensions before they are compared. Tiny images
+// such as icons and avatars have pHashes that collapse toward each other and cause false positives.
+// Zero is no limit.
+type Filter struct {
+	MinSize, MaxSize    int64 // bytes
+	MinWidth, MinHeight int
+	MaxWidth, MaxHeight int
+}
+
+// Dimensions looks up the width and height of an unchanged file without reading it, e.g. hash.Cache.Dimensions.
+type Dimensions func(fileName string, size int64, modTime time.Time) (int, int, bool)
+
+// ParseDimensions parses WIDTHxHEIGHT, e.g. 128x128. Either may be 0 to not limit it.
+func ParseDimensions(s string) (int, int, error) {
+	var width, height, found = strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	if !found {
+		return 0, 0, fmt.Errorf("%w: %q, expected WIDTHxHEIGHT e.g. 128x128", ErrBadDimensions, s)
+	}
+	var w, err = strconv.Atoi(width)
+	if err != nil || w < 0 {
+		return 0, 0, fmt.Errorf("%w: %q, bad width", ErrBadDimensions, s)
+	}
+	h, err := strconv.Atoi(height)
+	if err != nil || h < 0 {
+		return 0, 0, fmt.Errorf("%w: %q, bad height", ErrBadDimensions, s)
+	}
+	return w, h, nil
+}
+
+// String describes the limits, it is part of the fingerprint of a run so changing them starts over.
+func (f Filter) String() string {
+	return fmt.Sprintf("size %d-%d, dimensions %dx%d-%dx%d", f.MinSize, f.MaxSize, f.MinWidth, f.MinHeight, f.MaxWidth, f.MaxHeight)
+}
+
+// limitsDimensions returns true when any of the pixel limits is set.
+func (f Filter) limitsDimensions() bool {
+	return f.MinWidth > 0 || f.MinHeight > 0 || f.MaxWidth > 0 || f.MaxHeight > 0
+}
+
+// Apply returns the files within the limits and records the others in skipped. The dimensions come from
+// cached when it knows them, otherwise only the image header is read. A file whose header can not be
+// read is kept, hashing it will report the error.
+func (f Filter) Apply(files []path.Entry, cached Dimensions, skipped Skipped) []path.Entry {
+	if f == (Filter{}) {
+		return files
+	}
+
+	var kept = make([]path.Entry, 0, len(files))
+	for _, file := range files {
+		if reason := f.check(file, cached); reason != "" {
+			skipped.skip(reason, file.AbsolutePath)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
+
+// check returns why the file is skipped, or nothing when it is kept.
+func (f Filter) check(file path.Entry, cached Dimensions) string {
+	var size = file.FileInfo.Size()
+	switch {
+	case f.MinSize > 0 && size < f.MinSize:
+		return SkipTooSmall
+	case f.MaxSize > 0 && size > f.MaxSize:
+		return SkipTooLarge
+	case !f.limitsDimensions():
+		return ""
+	}
+
+	var width, height int
+	var ok bool
+	if cached != nil {
+		width, height, ok = cached(file.AbsolutePath, size, file.FileInfo.ModTime())
+	}
+	if !ok {
+		var config, err = decodeConfig(file.AbsolutePath)
+		if err != nil {
+			return ""
+		}
+		width, height = config.Width, config.Height
+	}
+
+	switch {
+	case f.MinWidth > 0 && width < f.MinWidth, f.MinHeight > 0 && height < f.MinHeight:
+		return SkipTooFewPixels
+	case f.MaxWidth > 0 && width > f.MaxWidth, f.MaxHeight > 0 && height > f.MaxHeight:
+		return SkipTooManyPixels
+	}
+	return ""
+}
+
+// decodeConfig reads the dimensions from the image header without decoding the image.
+func decodeConfig(fileName string) (image.Config, error) {
+	// #nosec G304: fileName was found in a dir or list we were asked to dedup.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("unable to open file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only
+	}()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("unable to decode image config: %s, err: %w", fileName, err)
+	}
+	return config, nil
+}
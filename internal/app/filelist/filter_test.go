@@ -0,0 +1,85 @@
+package filelist
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kmulvey/path"
+	"github.com/stretchr/testify/assert"
+)
+
+// writePNG writes a blank png and returns it as a listed file.
+func writePNG(t *testing.T, dir, name string, width, height int) path.Entry {
+	t.Helper()
+
+	var fileName = filepath.Join(dir, name)
+	var f, err = os.Create(fileName)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, image.NewGray(image.Rect(0, 0, width, height))))
+	assert.NoError(t, f.Close())
+
+	info, err := os.Stat(fileName)
+	assert.NoError(t, err)
+	return path.Entry{AbsolutePath: fileName, FileInfo: info}
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	var dir = t.TempDir()
+	var icon = writePNG(t, dir, "icon.png", 16, 16)
+	var banner = writePNG(t, dir, "banner.png", 600, 20)
+	var photo = writePNG(t, dir, "photo.png", 400, 300)
+	var files = []path.Entry{icon, banner, photo}
+
+	var skipped = make(Skipped)
+	assert.Equal(t, files, Filter{}.Apply(files, nil, skipped))
+	assert.Empty(t, skipped)
+
+	var kept = Filter{MinWidth: 64, MinHeight: 64}.Apply(files, nil, skipped)
+	assert.Equal(t, []string{photo.AbsolutePath}, path.OnlyNames(kept))
+	assert.Equal(t, 2, skipped.Count(SkipTooFewPixels))
+
+	// cached dimensions win over the header
+	var cached = func(fileName string, _ int64, _ time.Time) (int, int, bool) {
+		return 1000, 1000, fileName == icon.AbsolutePath
+	}
+	kept = Filter{MinWidth: 64, MaxWidth: 500}.Apply(files, cached, skipped)
+	assert.Equal(t, []string{photo.AbsolutePath}, path.OnlyNames(kept))
+	assert.Equal(t, 2, skipped.Count(SkipTooManyPixels), "the icon is 1000 wide says the cache, the banner 600 says its header")
+
+	kept = Filter{MinSize: photo.FileInfo.Size()}.Apply(files, nil, skipped)
+	assert.Equal(t, []string{photo.AbsolutePath}, path.OnlyNames(kept))
+	kept = Filter{MaxSize: icon.FileInfo.Size()}.Apply(files, nil, skipped)
+	assert.Equal(t, []string{icon.AbsolutePath}, path.OnlyNames(kept))
+	assert.Positive(t, skipped.Count(SkipTooSmall))
+	assert.Positive(t, skipped.Count(SkipTooLarge))
+
+	// a file that is not an image is left for hashing to report
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.png"), []byte("not a png"), 0600))
+	info, err := os.Stat(filepath.Join(dir, "broken.png"))
+	assert.NoError(t, err)
+	var broken = path.Entry{AbsolutePath: filepath.Join(dir, "broken.png"), FileInfo: info}
+	assert.Len(t, Filter{MinWidth: 64}.Apply([]path.Entry{broken}, nil, skipped), 1)
+}
+
+func TestParseDimensions(t *testing.T) {
+	t.Parallel()
+
+	var width, height, err = ParseDimensions("128x96")
+	assert.NoError(t, err)
+	assert.Equal(t, [2]int{128, 96}, [2]int{width, height})
+
+	width, height, err = ParseDimensions(" 0X64 ")
+	assert.NoError(t, err)
+	assert.Equal(t, [2]int{0, 64}, [2]int{width, height})
+
+	for _, bad := range []string{"128", "ax1", "1x", "-1x5"} {
+		_, _, err = ParseDimensions(bad)
+		assert.ErrorIs(t, err, ErrBadDimensions, bad)
+	}
+}
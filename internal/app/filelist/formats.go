@@ -0,0 +1,134 @@
+package filelist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SkipFormat is the reason for images in a format that was not asked for.
+const SkipFormat = "other formats"
+
+// ErrUnknownFormat is returned when parsing a format we can not hash.
+var ErrUnknownFormat = errors.New("unknown image format")
+
+// format is an image format we can recognize by its first bytes.
+type format struct {
+	name       string
+	extensions []string
+	magic      func(header []byte) bool
+	decodable  bool // the image package can decode it, only those can be hashed
+}
+
+// formats are the formats we recognize, webp is only recognized so a webp named .jpg is reported.
+var formats = []format{
+	{"jpeg", []string{".jpg", ".jpeg", ".jpe", ".jfif"}, func(h []byte) bool { return bytes.HasPrefix(h, []byte{0xff, 0xd8, 0xff}) }, true},
+	{"png", []string{".png"}, func(h []byte) bool { return bytes.HasPrefix(h, []byte("\x89PNG\r\n\x1a\n")) }, true},
+	{"gif", []string{".gif"}, func(h []byte) bool { return bytes.HasPrefix(h, []byte("GIF8")) }, true}, // GIF87a or GIF89a
+	{"webp", []string{".webp"}, func(h []byte) bool { return len(h) >= 12 && string(h[:4]) == "RIFF" && string(h[8:12]) == "WEBP" }, false},
+}
+
+// Formats are the names of the image formats to dedup.
+type Formats []string
+
+// DefaultFormats are the formats deduped unless -formats says otherwise.
+var DefaultFormats = Formats{"jpeg", "png"}
+
+// ParseFormats parses a comma separated list of formats, e.g. jpeg,png,gif.
+func ParseFormats(list string) (Formats, error) {
+	var parsed Formats
+	for name := range strings.SplitSeq(strings.ToLower(list), ",") {
+		name = strings.TrimSpace(name)
+		if name == "jpg" {
+			name = "jpeg"
+		}
+		var i = slices.IndexFunc(formats, func(f format) bool { return f.name == name })
+		switch {
+		case name == "":
+			continue
+		case i < 0:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+		case !formats[i].decodable:
+			return nil, fmt.Errorf("%w: %s can be recognized but not decoded", ErrUnknownFormat, name)
+		}
+		if !slices.Contains(parsed, name) {
+			parsed = append(parsed, name)
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: no formats in %q", ErrUnknownFormat, list)
+	}
+	return parsed, nil
+}
+
+// String fulfils the fmt.Stringer interface.
+func (fs Formats) String() string {
+	return strings.Join(fs, ",")
+}
+
+// Regex matches the file names with an extension of one of the formats, in any case.
+func (fs Formats) Regex() *regexp.Regexp {
+	var extensions []string
+	for _, f := range formats {
+		if slices.Contains(fs, f.name) {
+			for _, ext := range f.extensions {
+				extensions = append(extensions, regexp.QuoteMeta(ext))
+			}
+		}
+	}
+	return regexp.MustCompile(`(?i)(` + strings.Join(extensions, "|") + `)$`)
+}
+
+// Mismatch is a file whose content is in another format than its extension says, e.g. a png named .jpg.
+type Mismatch struct {
+	Path      string
+	Extension string // the format the extension belongs to
+	Content   string // the format of the first bytes
+}
+
+// String fulfils the fmt.Stringer interface.
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s is a %s named like a %s", m.Path, m.Content, m.Extension)
+}
+
+// formatOfExtension returns the format the extension of name belongs to, or nothing.
+func formatOfExtension(name string) string {
+	var ext = strings.ToLower(filepath.Ext(name))
+	for _, f := range formats {
+		if slices.Contains(f.extensions, ext) {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// Sniff returns the format of the file by its first bytes, or nothing when it is not an image we recognize.
+func Sniff(fileName string) (string, error) {
+	// #nosec G304: fileName was found in a dir or list we were asked to dedup.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return "", fmt.Errorf("unable to open file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only
+	}()
+
+	var header = make([]byte, 12)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("unable to read file: %s, err: %w", fileName, err)
+	}
+
+	for _, format := range formats {
+		if format.magic(header[:n]) {
+			return format.name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,68 @@
+package filelist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kmulvey/path"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormats(t *testing.T) {
+	t.Parallel()
+
+	var formats, err = ParseFormats(" JPG, png,jpeg ")
+	assert.NoError(t, err)
+	assert.Equal(t, Formats{"jpeg", "png"}, formats)
+	assert.Equal(t, "jpeg,png", formats.String())
+
+	_, err = ParseFormats("jpeg,bmp")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	_, err = ParseFormats("webp")
+	assert.ErrorIs(t, err, ErrUnknownFormat, "webp is recognized but there is no decoder for it")
+	_, err = ParseFormats(",")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestFormatsRegex(t *testing.T) {
+	t.Parallel()
+
+	var regex = DefaultFormats.Regex()
+	for _, name := range []string{"a.jpg", "a.JPG", "a.Jpeg", "a.jpe", "a.jfif", "a.PNG", "dir.jpg/a.png"} {
+		assert.True(t, regex.MatchString(name), name)
+	}
+	for _, name := range []string{"ajpg", "a_jpg", "a.jpg.txt", "a.gif", "a.webp", "a"} {
+		assert.False(t, regex.MatchString(name), name)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	t.Parallel()
+
+	var dir = t.TempDir()
+	var png = writePNG(t, dir, "photo.jpg", 8, 8) // named like a jpeg
+	jpeg, err := os.ReadFile("../imagedup/testimages/trees.jpg")
+	assert.NoError(t, err)
+	for name, data := range map[string][]byte{
+		"IMG_0001":  jpeg, // camera dump without an extension
+		"anim.gif":  []byte("GIF89a..."),
+		"notes.jpg": []byte("not an image"),
+		"empty.png": nil,
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+	}
+
+	format, err := Sniff(png.AbsolutePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "png", format)
+	format, err = Sniff(filepath.Join(dir, "empty.png"))
+	assert.NoError(t, err)
+	assert.Empty(t, format)
+
+	var listing, listErr = Sources{Dirs: []string{dir}, Depth: 1, Images: images, Sniff: DefaultFormats}.List()
+	assert.NoError(t, listErr)
+	assert.Equal(t, []string{filepath.Join(dir, "IMG_0001"), png.AbsolutePath}, path.OnlyNames(listing.Files))
+	assert.Equal(t, []Mismatch{{Path: png.AbsolutePath, Extension: "jpeg", Content: "png"}}, listing.Mismatched)
+	assert.Equal(t, 1, listing.Skipped.Count(SkipFormat), "the gif")
+}
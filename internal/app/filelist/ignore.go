@@ -0,0 +1,177 @@
+package filelist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the name of the per dir ignore files, they work like .gitignore.
+const IgnoreFileName = ".imagedupignore"
+
+// ErrBadPattern is returned for exclude patterns that can not be parsed.
+var ErrBadPattern = errors.New("invalid exclude pattern")
+
+// Pattern is a single gitignore style exclude pattern.
+type Pattern struct {
+	base     string   // dir the pattern is relative to
+	segments []string // split on /
+	negate   bool     // ! re-includes what an earlier pattern excluded
+	dirOnly  bool     // a trailing / only matches dirs
+	anchored bool     // a / anywhere but the end matches from base, otherwise the name is matched at any depth
+	raw      string
+}
+
+// ParsePattern parses a gitignore style pattern relative to base, e.g. @eaDir/, *.lrprev or /exports/**/thumbs.
+func ParsePattern(pattern, base string) (Pattern, error) {
+	var p = Pattern{base: filepath.Clean(base), raw: pattern}
+
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		p.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	if pattern == "" {
+		return Pattern{}, fmt.Errorf("%w: %q", ErrBadPattern, p.raw)
+	}
+
+	p.segments = strings.Split(pattern, "/")
+	for _, segment := range p.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return Pattern{}, fmt.Errorf("%w: %q, err: %w", ErrBadPattern, p.raw, err)
+		}
+	}
+	return p, nil
+}
+
+// String returns the pattern as it was written.
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// match returns true when the pattern matches the file or dir at name, an absolute path.
+func (p Pattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	var rel, err = filepath.Rel(p.base, name)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	var segments = strings.Split(filepath.ToSlash(rel), "/")
+	if !p.anchored {
+		var matched, _ = path.Match(p.segments[0], segments[len(segments)-1])
+		return matched
+	}
+	return matchSegments(p.segments, segments)
+}
+
+// matchSegments matches a pattern against a path one segment at a time, ** matches any number of segments.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	var matched, _ = path.Match(pattern[0], name[0])
+	return matched && matchSegments(pattern[1:], name[1:])
+}
+
+// Patterns is a list of patterns, the last one that matches decides.
+type Patterns []Pattern
+
+// ParsePatterns parses exclude patterns given on the command line, they are relative to base.
+func ParsePatterns(base string, patterns ...string) (Patterns, error) {
+	var parsed = make(Patterns, 0, len(patterns))
+	for _, pattern := range patterns {
+		var p, err = ParsePattern(pattern, base)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// LoadIgnoreFile reads the ignore file in dir, a dir without one has no patterns.
+// Blank lines and lines starting with # are skipped.
+func LoadIgnoreFile(dir string) (Patterns, error) {
+	var fileName = filepath.Join(dir, IgnoreFileName)
+	// #nosec G304: the ignore file is in a dir we were asked to list.
+	var f, err = os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to open ignore file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only
+	}()
+
+	var patterns Patterns
+	var scanner = bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var text = strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var p, err = ParsePattern(text, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", fileName, line, err)
+		}
+		patterns = append(patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read ignore file: %s, err: %w", fileName, err)
+	}
+	return patterns, nil
+}
+
+// Excluded returns true when the last pattern matching name excludes it.
+func (ps Patterns) Excluded(name string, isDir bool) bool {
+	var excluded bool
+	for _, p := range ps {
+		if p.match(name, isDir) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// ExcludedPath is Excluded for a file that was not reached by walking its dirs, e.g. from a list of files.
+// The file is excluded if it or any dir it is in is excluded.
+func (ps Patterns) ExcludedPath(name string) bool {
+	var dirs []string
+	for dir := filepath.Dir(name); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if ps.Excluded(dirs[i], true) {
+			return true
+		}
+	}
+	return ps.Excluded(name, false)
+}
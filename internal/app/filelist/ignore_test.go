@@ -0,0 +1,42 @@
+package filelist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatterns(t *testing.T) {
+	t.Parallel()
+
+	var patterns, err = ParsePatterns("/photos", "*.lrprev", "@eaDir/", "/exports/**/thumbs", "!exports/2020/thumbs", `\#tmp`)
+	assert.NoError(t, err)
+
+	var tests = []struct {
+		name     string
+		isDir    bool
+		excluded bool
+	}{
+		{"/photos/a.lrprev", false, true},
+		{"/photos/trip/a.lrprev", false, true},
+		{"/photos/trip/@eaDir", true, true},
+		{"/photos/trip/@eaDir", false, false}, // only dirs
+		{"/photos/exports/thumbs", true, true},
+		{"/photos/exports/2019/x/thumbs", true, true},
+		{"/photos/exports/2020/thumbs", true, false}, // re-included by the last pattern
+		{"/photos/trip/exports/thumbs", true, false}, // anchored at /photos
+		{"/other/a.lrprev", false, false},            // outside of the base
+		{"/photos/#tmp", false, true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.excluded, patterns.Excluded(test.name, test.isDir), test.name)
+	}
+
+	assert.True(t, patterns.ExcludedPath("/photos/trip/@eaDir/a.jpg"))
+	assert.False(t, patterns.ExcludedPath("/photos/trip/a.jpg"))
+
+	_, err = ParsePatterns("/photos", "[")
+	assert.ErrorIs(t, err, ErrBadPattern)
+	_, err = ParsePatterns("/photos", "/")
+	assert.ErrorIs(t, err, ErrBadPattern)
+}
@@ -0,0 +1,165 @@
+package filelist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kmulvey/path"
+)
+
+// SkipSymlink is the reason for symlinks left out by SymlinksSkip.
+const SkipSymlink = "symlinks"
+
+// LinkReportFileName is the name of the link report uniqdirs writes to its output dir.
+const LinkReportFileName = "linked.json"
+
+// ErrUnknownSymlinkPolicy is returned when parsing a symlink policy we do not support.
+var ErrUnknownSymlinkPolicy = errors.New("unknown symlink policy")
+
+// SymlinkPolicy is what discovery does with symlinks to files and dirs.
+type SymlinkPolicy int
+
+const (
+	// SymlinksFollow lists symlinked files and walks symlinked dirs as if they were the real thing.
+	SymlinksFollow SymlinkPolicy = iota
+	// SymlinksSkip leaves out every symlink, e.g. for a symlink farm that points into the library.
+	SymlinksSkip
+)
+
+// String fulfils the fmt.Stringer interface.
+func (p SymlinkPolicy) String() string {
+	if p == SymlinksSkip {
+		return "skip"
+	}
+	return "follow"
+}
+
+// ParseSymlinkPolicy parses the name of a policy.
+func ParseSymlinkPolicy(name string) (SymlinkPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "follow":
+		return SymlinksFollow, nil
+	case "skip":
+		return SymlinksSkip, nil
+	default:
+		return SymlinksFollow, fmt.Errorf("%w: %s", ErrUnknownSymlinkPolicy, name)
+	}
+}
+
+// Links maps a listed file to the other paths it was reached through, hardlinks or symlinks to the same
+// device and inode. They are the same file, not duplicates, deleting one of them saves no space.
+type Links map[string][]string
+
+// add records that the names are the same file as listed, the same path twice is not a link.
+func (l Links) add(listed string, names ...string) {
+	for _, name := range names {
+		if name != listed && !slices.Contains(l[listed], name) {
+			l[listed] = append(l[listed], name)
+		}
+	}
+}
+
+// Add adds the links of other, e.g. of another dir.
+func (l Links) Add(other Links) {
+	for listed, names := range other {
+		l.add(listed, names...)
+	}
+}
+
+// Paths returns how many paths are links to a listed file.
+func (l Links) Paths() int {
+	var n int
+	for _, links := range l {
+		n += len(links)
+	}
+	return n
+}
+
+// DropLinked removes the files that are the same file as one of other, e.g. the reference library, and
+// records them as links to it. Comparing them would find a duplicate whose deletion saves no space.
+func (l *Listing) DropLinked(other []path.Entry) {
+	var ids = make(map[string]string, len(other))
+	for _, entry := range other {
+		ids[identity(entry.AbsolutePath, entry.FileInfo)] = entry.AbsolutePath
+	}
+
+	var kept = l.Files[:0]
+	for _, entry := range l.Files {
+		if first, found := ids[identity(entry.AbsolutePath, entry.FileInfo)]; found {
+			if first != entry.AbsolutePath {
+				l.Linked.add(first, entry.AbsolutePath)
+				l.Linked.add(first, l.Linked[entry.AbsolutePath]...)
+				delete(l.Linked, entry.AbsolutePath)
+			}
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	l.Files = kept
+}
+
+// LinkGroup is the paths of a file that is already linked, the first one is the one that was listed.
+type LinkGroup struct {
+	Paths []string `json:"paths"`
+}
+
+// LinkReport is the already linked files of a run, written next to its delete log.
+type LinkReport struct {
+	Created time.Time   `json:"created"`
+	Groups  []LinkGroup `json:"groups"`
+}
+
+// Report returns the groups sorted by the listed file.
+func (l Links) Report() *LinkReport {
+	var report = &LinkReport{Created: time.Now(), Groups: make([]LinkGroup, 0, len(l))}
+	for _, listed := range slices.Sorted(maps.Keys(l)) {
+		report.Groups = append(report.Groups, LinkGroup{Paths: append([]string{listed}, l[listed]...)})
+	}
+	return report
+}
+
+// WriteJSON writes the report to fileName, replacing the report of an earlier run.
+func (r *LinkReport) WriteJSON(fileName string) error {
+	var data, err = json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode link report: %s, err: %w", fileName, err)
+	}
+	if err := os.WriteFile(fileName, data, 0600); err != nil {
+		return fmt.Errorf("unable to write link report: %s, err: %w", fileName, err)
+	}
+	return nil
+}
+
+// ReadLinkReport reads a report written by WriteJSON.
+func ReadLinkReport(fileName string) (*LinkReport, error) {
+	// #nosec G304: fileName is given to us by the user.
+	var data, err = os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read link report: %s, err: %w", fileName, err)
+	}
+	var report = new(LinkReport)
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("unable to decode link report: %s, err: %w", fileName, err)
+	}
+	return report, nil
+}
+
+// identity returns what tells files apart, the device and inode where the platform has them and
+// the path with every symlink resolved elsewhere, which catches symlinks but not hardlinks.
+func identity(name string, info os.FileInfo) string {
+	if id, ok := fileID(info); ok {
+		return id
+	}
+	var real, err = filepath.EvalSymlinks(name)
+	if err != nil {
+		return name
+	}
+	return real
+}
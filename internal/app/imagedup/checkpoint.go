@@ -0,0 +1,105 @@
+package imagedup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrCheckpointMismatch is returned when a checkpoint was written for other files or settings.
+var ErrCheckpointMismatch = errors.New("checkpoint does not match this run")
+
+// Checkpoint is how far an interrupted run got, RowsDone files from the start of the list, or of
+// NewFiles for an incremental run, were compared to every other file and all their duplicates are in the delete log.
+type Checkpoint struct {
+	Fingerprint string    `json:"fingerprint"` // of the file list and distance, see manifest.Fingerprint
+	DedupPairs  bool      `json:"dedup_pairs"`
+	Incremental bool      `json:"incremental,omitempty"`
+	Files       int       `json:"files"`
+	NewFiles    []string  `json:"new_files,omitempty"` // the files an incremental run compares, they are cached once the run stops
+	RowsDone    int       `json:"rows_done"`
+	Updated     time.Time `json:"updated"`
+	// Completed is every file of the last run that finished, they were all compared to each other. Runs that
+	// do not finish carry it over, an incremental run only compares the files that are not in it.
+	Completed map[string]FileState `json:"completed,omitempty"`
+}
+
+// FileState is the size and mtime a file had when it was compared.
+type FileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ReadCheckpoint reads a checkpoint file.
+func ReadCheckpoint(fileName string) (*Checkpoint, error) {
+	// #nosec G304: fileName is given to us by the user.
+	var data, err = os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint: %s, err: %w", fileName, err)
+	}
+
+	var c = new(Checkpoint)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal checkpoint: %s, err: %w", fileName, err)
+	}
+	return c, nil
+}
+
+// Resumes returns the row to restart at if the checkpoint was written for the same files and settings as current.
+func (c *Checkpoint) Resumes(current *Checkpoint) (int, error) {
+	if c.Fingerprint != current.Fingerprint || c.Files != current.Files {
+		return 0, fmt.Errorf("%w: the files or -distance changed since it was written", ErrCheckpointMismatch)
+	}
+	if c.DedupPairs != current.DedupPairs {
+		return 0, fmt.Errorf("%w: it was written with dedup pairs %t", ErrCheckpointMismatch, c.DedupPairs)
+	}
+	if c.Incremental != current.Incremental {
+		return 0, fmt.Errorf("%w: it was written with incremental %t", ErrCheckpointMismatch, c.Incremental)
+	}
+	return min(c.RowsDone, c.Rows()), nil
+}
+
+// Rows is the number of rows of the run, the rows are the new files for an incremental run.
+func (c *Checkpoint) Rows() int {
+	if c.Incremental {
+		return len(c.NewFiles)
+	}
+	return c.Files
+}
+
+// Finished returns true when every row of the run is done.
+func (c *Checkpoint) Finished() bool {
+	return c.RowsDone >= c.Rows()
+}
+
+// Changed returns the files that are not in Completed or changed since, in the order of files.
+func (c *Checkpoint) Changed(files []string, states map[string]FileState) []string {
+	var changed []string
+	for _, file := range files {
+		var completed, found = c.Completed[file]
+		if !found || completed.Size != states[file].Size || !completed.ModTime.Equal(states[file].ModTime) {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// Write saves the checkpoint, it is written to a temp file first so a crash never leaves half a checkpoint.
+func (c *Checkpoint) Write(fileName string) error {
+	c.Updated = time.Now()
+	var data, err = json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal checkpoint, err: %w", err)
+	}
+
+	var tmp = fileName + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write checkpoint: %s, err: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, fileName); err != nil {
+		return fmt.Errorf("unable to rename checkpoint: %s, err: %w", tmp, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package imagedup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	var fileName = filepath.Join(t.TempDir(), "checkpoint.json")
+	var c = &Checkpoint{Fingerprint: "abc", Files: 10, RowsDone: 4}
+	assert.NoError(t, c.Write(fileName))
+
+	c, err := ReadCheckpoint(fileName)
+	assert.NoError(t, err)
+	assert.False(t, c.Updated.IsZero())
+
+	row, err := c.Resumes(&Checkpoint{Fingerprint: "abc", Files: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, row)
+
+	_, err = c.Resumes(&Checkpoint{Fingerprint: "def", Files: 10})
+	assert.ErrorIs(t, err, ErrCheckpointMismatch)
+	_, err = c.Resumes(&Checkpoint{Fingerprint: "abc", Files: 11})
+	assert.ErrorIs(t, err, ErrCheckpointMismatch)
+	_, err = c.Resumes(&Checkpoint{Fingerprint: "abc", Files: 10, DedupPairs: true})
+	assert.ErrorIs(t, err, ErrCheckpointMismatch)
+	_, err = c.Resumes(&Checkpoint{Fingerprint: "abc", Files: 10, Incremental: true})
+	assert.ErrorIs(t, err, ErrCheckpointMismatch)
+
+	// the rows of an incremental run are its new files
+	c = &Checkpoint{Fingerprint: "abc", Files: 10, Incremental: true, NewFiles: []string{"a", "b"}, RowsDone: 1}
+	assert.NoError(t, c.Write(fileName))
+	c, err = ReadCheckpoint(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.Rows())
+	row, err = c.Resumes(&Checkpoint{Fingerprint: "abc", Files: 10, Incremental: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, row)
+
+	assert.False(t, c.Finished())
+
+	// an incremental run compares the files the last finished run did not
+	var now = time.Now()
+	var states = map[string]FileState{"a": {Size: 1, ModTime: now}, "b": {Size: 2, ModTime: now}, "c": {Size: 3, ModTime: now}}
+	c = &Checkpoint{Files: 3, RowsDone: 3, Completed: map[string]FileState{"a": {Size: 1, ModTime: now}, "b": {Size: 5, ModTime: now}}}
+	assert.True(t, c.Finished())
+	assert.NoError(t, c.Write(fileName))
+	c, err = ReadCheckpoint(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, c.Changed([]string{"a", "b", "c"}, states))
+	assert.Equal(t, []string{"a", "b", "c"}, (&Checkpoint{}).Changed([]string{"a", "b", "c"}, states))
+
+	_, err = ReadCheckpoint(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -2,17 +2,17 @@ package imagedup
 
 import (
 	"context"
-	"regexp"
 
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
 	"github.com/kmulvey/imagedup/v2/pkg/imagedup/types"
 )
 
-// ImageExtensionRegex captures file extensions we can work with.
-var ImageExtensionRegex = regexp.MustCompile(".*.jpg$|.*.jpeg$|.*.png$|.*.webp$|.*.JPG$|.*.JPEG$|.*.PNG$|.*.WEBP$")
+// ImageExtensionRegex matches the extensions of the default formats in any case, e.g. .jpg, .JPEG, .jfif or .png.
+var ImageExtensionRegex = filelist.DefaultFormats.Regex()
 
 // streamFiles generates roughly n^2 comparisons and writes them to a channel that
-// is read by the diff workers.
-func (id *ImageDup) streamFiles(ctx context.Context, files []string) {
+// is read by the diff workers. The rows before firstRow were streamed by an earlier run and are skipped.
+func (id *ImageDup) streamFiles(ctx context.Context, files []string, firstRow int, progress *progress) {
 	var numImages = float64(len(files))
 	if id.dedupPairs {
 		id.stats.TotalComparisons.Set(((numImages * numImages) - numImages) / 2)
@@ -20,7 +20,8 @@ func (id *ImageDup) streamFiles(ctx context.Context, files []string) {
 		id.stats.TotalComparisons.Set(((numImages * numImages) - numImages))
 	}
 
-	for i, one := range files {
+	for i := firstRow; i < len(files); i++ {
+		var one = files[i]
 		for j, two := range files {
 			if i != j { // dont diff yourself
 				select {
@@ -29,10 +30,15 @@ func (id *ImageDup) streamFiles(ctx context.Context, files []string) {
 					return
 				default:
 					if id.dedupPairs {
+						if j < firstRow {
+							continue // the earlier run already compared two & one
+						}
+
 						id.bitmapLock.Lock()
 
 						if _, found := id.dedupCache[one+" "+two]; !found {
-							id.images <- types.Pair{One: one, Two: two}
+							progress.sent(i)
+							id.images <- types.Pair{One: one, Two: two, Row: i}
 							id.dedupCache[two+" "+one] = struct{}{} // we set the opposite pair so we skip it next time
 							id.stats.PairTotal.Inc()
 							id.stats.FileMapMisses.Inc()
@@ -41,12 +47,76 @@ func (id *ImageDup) streamFiles(ctx context.Context, files []string) {
 
 						id.bitmapLock.Unlock()
 					} else {
-						id.images <- types.Pair{One: one, Two: two}
+						progress.sent(i)
+						id.images <- types.Pair{One: one, Two: two, Row: i}
 						id.stats.PairTotal.Inc()
 					}
 				}
 			}
 		}
+		progress.rowStreamed(i)
+	}
+	close(id.images)
+}
+
+// streamNewFiles compares every new file to every other file, each pair only once. Pairs of two old files
+// were compared by an earlier run and are skipped, which turns n^2 into roughly new * n comparisons.
+// The rows are the new files, the ones before firstRow were streamed by an interrupted run.
+func (id *ImageDup) streamNewFiles(ctx context.Context, files, newFiles []string, firstRow int, progress *progress) {
+	var newRow = make(map[string]int, len(newFiles))
+	for i, file := range newFiles {
+		newRow[file] = i
+	}
+
+	var numNew, numImages = float64(len(newFiles)), float64(len(files))
+	id.stats.TotalComparisons.Set(numNew*(numImages-numNew) + (numNew*numNew-numNew)/2)
+
+	for i := firstRow; i < len(newFiles); i++ {
+		var one = newFiles[i]
+		for _, two := range files {
+			if row, isNew := newRow[two]; isNew && row <= i {
+				continue // yourself, or a new file whose row already compared it to this one
+			}
+
+			select {
+			case <-ctx.Done():
+				close(id.images)
+				return
+			default:
+				progress.sent(i)
+				id.images <- types.Pair{One: one, Two: two, Row: i}
+				id.stats.PairTotal.Inc()
+			}
+		}
+		progress.rowStreamed(i)
+	}
+	close(id.images)
+}
+
+// streamAgainst compares every file to every image of a reference library and nothing else, the reference
+// images are never compared to each other. The rows are the files, the ones before firstRow were streamed
+// by an interrupted run.
+func (id *ImageDup) streamAgainst(ctx context.Context, files, reference []string, firstRow int, progress *progress) {
+	id.stats.TotalComparisons.Set(float64(len(files)) * float64(len(reference)))
+
+	for i := firstRow; i < len(files); i++ {
+		var one = files[i]
+		for _, two := range reference {
+			if one == two {
+				continue // dont diff yourself when the files are inside the reference library
+			}
+
+			select {
+			case <-ctx.Done():
+				close(id.images)
+				return
+			default:
+				progress.sent(i)
+				id.images <- types.Pair{One: one, Two: two, Row: i, Reference: true}
+				id.stats.PairTotal.Inc()
+			}
+		}
+		progress.rowStreamed(i)
 	}
 	close(id.images)
 }
@@ -6,14 +6,17 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/types"
 	"github.com/kmulvey/path"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
 func testStreamFilesHelper(t *testing.T, cacheFile string, dedupPairs bool, expectedPairs map[string]struct{}) {
 	t.Helper()
 
-	var id, err = NewImageDup(cacheFile, cacheFile, 2, 3, 10, dedupPairs)
+	var id, err = NewImageDup(metrics.Options{Registerer: prometheus.NewRegistry()}, cacheFile, 2, 3, 10, dedupPairs)
 	assert.NoError(t, err)
 
 	var done = make(chan struct{})
@@ -30,7 +33,7 @@ func testStreamFilesHelper(t *testing.T, cacheFile string, dedupPairs bool, expe
 	assert.NoError(t, err)
 	var fileNames = path.OnlyNames(files)
 
-	id.streamFiles(t.Context(), fileNames)
+	id.streamFiles(t.Context(), fileNames, 0, newProgress(len(fileNames), 0))
 
 	<-done
 
@@ -59,11 +62,96 @@ func TestStreamFilesDedup(t *testing.T) {
 	testStreamFilesHelper(t, "TestStreamFilesDedup", true, expectedPairs)
 }
 
+func TestStreamFilesResume(t *testing.T) {
+	t.Parallel()
+
+	for _, dedupPairs := range []bool{false, true} {
+		var cacheFile = "TestStreamFilesResume.json"
+		var id, err = NewImageDup(metrics.Options{Registerer: prometheus.NewRegistry()}, cacheFile, 2, 3, 10, dedupPairs)
+		assert.NoError(t, err)
+
+		var pairs []string
+		var done = make(chan struct{})
+		go func() {
+			for img := range id.images {
+				pairs = append(pairs, img.One+img.Two)
+			}
+			close(done)
+		}()
+
+		var progress = newProgress(3, 1)
+		id.streamFiles(t.Context(), []string{"a", "b", "c"}, 1, progress)
+		<-done
+
+		if dedupPairs {
+			assert.Equal(t, []string{"bc"}, pairs, "a was compared to everything in the first run")
+		} else {
+			assert.Equal(t, []string{"ba", "bc", "ca", "cb"}, pairs)
+		}
+		assert.Equal(t, 1, progress.rowsDone(), "nothing was diffed")
+		assert.NoError(t, os.RemoveAll(cacheFile))
+	}
+}
+
+func TestStreamNewFiles(t *testing.T) {
+	t.Parallel()
+
+	var cacheFile = "TestStreamNewFiles.json"
+	var id, err = NewImageDup(metrics.Options{Registerer: prometheus.NewRegistry()}, cacheFile, 2, 3, 10, false)
+	assert.NoError(t, err)
+
+	for _, firstRow := range []int{0, 1} {
+		id.images = make(chan types.Pair)
+		var pairs []string
+		var done = make(chan struct{})
+		go func() {
+			for img := range id.images {
+				pairs = append(pairs, img.One+img.Two)
+			}
+			close(done)
+		}()
+
+		id.streamNewFiles(t.Context(), []string{"a", "b", "c", "d"}, []string{"b", "d"}, firstRow, newProgress(2, firstRow))
+		<-done
+
+		if firstRow == 0 {
+			assert.Equal(t, []string{"ba", "bc", "bd", "da", "dc"}, pairs, "a & c are old, they are never compared to each other")
+		} else {
+			assert.Equal(t, []string{"da", "dc"}, pairs, "b was done by the interrupted run")
+		}
+	}
+	assert.NoError(t, os.RemoveAll(cacheFile))
+}
+
+func TestStreamAgainst(t *testing.T) {
+	t.Parallel()
+
+	var cacheFile = "TestStreamAgainst.json"
+	var id, err = NewImageDup(metrics.Options{Registerer: prometheus.NewRegistry()}, cacheFile, 2, 3, 10, false)
+	assert.NoError(t, err)
+
+	var pairs []string
+	var done = make(chan struct{})
+	go func() {
+		for img := range id.images {
+			assert.True(t, img.Reference)
+			pairs = append(pairs, img.One+img.Two)
+		}
+		close(done)
+	}()
+
+	id.streamAgainst(t.Context(), []string{"a", "b"}, []string{"x", "b", "y"}, 0, newProgress(2, 0))
+	<-done
+
+	assert.Equal(t, []string{"ax", "ab", "ay", "bx", "by"}, pairs, "b is on both sides, it is not compared to itself")
+	assert.NoError(t, os.RemoveAll(cacheFile))
+}
+
 func TestStreamFilesCancel(t *testing.T) {
 	t.Parallel()
 
 	var cacheFile = "TestStreamFiles"
-	var id, err = NewImageDup("TestStreamFilesCancel", cacheFile, 2, 3, 10, true)
+	var id, err = NewImageDup(metrics.Options{Registerer: prometheus.NewRegistry()}, cacheFile, 2, 3, 10, true)
 	assert.NoError(t, err)
 
 	var done = make(chan struct{})
@@ -78,7 +166,7 @@ func TestStreamFilesCancel(t *testing.T) {
 	}()
 
 	var ctx, cancel = context.WithCancel(t.Context())
-	go id.streamFiles(ctx, make([]string, 100))
+	go id.streamFiles(ctx, make([]string, 100), 0, newProgress(100, 0))
 	cancel()
 
 	<-done
@@ -6,11 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"image"
-	"image/jpeg"
+	_ "image/gif" // register decoders for image.Decode, filelist.Formats are the ones registered here
+	_ "image/jpeg"
+	_ "image/png"
+	"maps"
 	"os"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/corona10/goimagehash"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -18,6 +24,7 @@ import (
 type Cache struct {
 	imageCacheHits   prometheus.Counter
 	imageCacheMisses prometheus.Counter
+	prom             metrics.Options
 	storeFileName    string
 	store            map[string]*Image
 	lock             sync.RWMutex
@@ -27,64 +34,96 @@ type Cache struct {
 type Image struct {
 	*goimagehash.ImageHash
 	image.Config `json:"-"`
+	Size         int64     // of the file when it was hashed, 0 for entries from old cache files
+	ModTime      time.Time // of the file when it was hashed, zero for entries from old cache files
+}
+
+// cacheEntry is how an image is stored in the cache file. Old cache files stored just the hash.
+type cacheEntry struct {
+	Hash    uint64    `json:"phash"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mtime,omitzero"`
+	Width   int       `json:"width,omitempty"`
+	Height  int       `json:"height,omitempty"`
 }
 
 // NewCache reads the given file to rebuild its map from the last time it was run.
-// If the file does not exist, it will be created.
-func NewCache(cacheFileName, promNamespace string, numFiles int) (*Cache, error) {
+// If the file does not exist, it will be created. The metrics are only registered once the file
+// has been read, so a cache that fails to load leaves nothing registered.
+func NewCache(cacheFileName string, prom metrics.Options, numFiles int) (*Cache, error) {
 	var c = new(Cache)
 	c.store = make(map[string]*Image, numFiles)
 	c.storeFileName = cacheFileName
-	c.imageCacheHits = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Namespace: promNamespace,
-			Name:      "image_hash_cache_hits",
-		},
-	)
-	c.imageCacheMisses = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Namespace: promNamespace,
-			Name:      "image_hash_cache_misses",
-		},
-	)
-	prometheus.MustRegister(c.imageCacheHits)
-	prometheus.MustRegister(c.imageCacheMisses)
+	c.prom = prom
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if c.imageCacheHits, err = metrics.Register(prom, prom.Counter("image_hash_cache_hits", "images whose hash was already in the cache")); err != nil {
+		return nil, err
+	}
+	if c.imageCacheMisses, err = metrics.Register(prom, prom.Counter("image_hash_cache_misses", "images that had to be hashed")); err != nil {
+		prom.Unregister(c.imageCacheHits)
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load reads the cache file, creating it if it does not exist.
+func (c *Cache) load() error {
+	var cacheFileName = c.storeFileName
 
 	// try to open the file, if it doesnt exist, create it
 	// #nosec G304: cacheFileName is provided by caller and expected to be a local
 	// cache file path for this CLI tool; opening it is intended behavior.
 	var f, err = os.OpenFile(cacheFileName, os.O_RDONLY|os.O_CREATE, 0600)
 	if err != nil {
-		return nil, fmt.Errorf("HashCache error opening file: %s, err: %w", cacheFileName, err)
+		return fmt.Errorf("HashCache error opening file: %s, err: %w", cacheFileName, err)
 	}
 
 	defer func() {
 		_ = f.Close() // hard to bubble this error in a defer
 		// if err != nil {
-		// 	return nil, fmt.Errorf("HashCache error closing file: %s, err: %w", cacheFileName, err)
+		// 	return fmt.Errorf("HashCache error closing file: %s, err: %w", cacheFileName, err)
 		// }
 	}()
 
 	if info, err := f.Stat(); err != nil {
-		return c, fmt.Errorf("HashCache error stating file: %s, err: %w", cacheFileName, err)
+		return fmt.Errorf("HashCache error stating file: %s, err: %w", cacheFileName, err)
 	} else if info.Size() == 0 {
-		return c, nil
+		return nil
 	}
 
 	// load array from file
-	var m = make(map[string]uint64, len(c.store))
+	var m = make(map[string]json.RawMessage, len(c.store))
 	err = json.NewDecoder(f).Decode(&m)
 	if err != nil {
-		return nil, fmt.Errorf("HashCache error decoding json file: %s, err: %w", cacheFileName, err)
+		return fmt.Errorf("HashCache error decoding json file: %s, err: %w", cacheFileName, err)
 	}
 
-	if len(m) > 0 {
-		for imageName, hash := range m {
-			c.store[imageName] = &Image{goimagehash.NewImageHash(hash, goimagehash.PHash), image.Config{}}
+	for imageName, raw := range m {
+		var entry cacheEntry
+		if len(raw) > 0 && raw[0] == '{' {
+			err = json.Unmarshal(raw, &entry)
+		} else {
+			err = json.Unmarshal(raw, &entry.Hash) // written by an older version
+		}
+		if err != nil {
+			return fmt.Errorf("HashCache error decoding entry: %s in json file: %s, err: %w", imageName, cacheFileName, err)
+		}
+
+		c.store[imageName] = &Image{
+			ImageHash: goimagehash.NewImageHash(entry.Hash, goimagehash.PHash),
+			Config:    image.Config{Width: entry.Width, Height: entry.Height},
+			Size:      entry.Size,
+			ModTime:   entry.ModTime,
 		}
 	}
 
-	return c, nil
+	return nil
 }
 
 // Stats returns the number of images in the cache
@@ -96,6 +135,49 @@ func (c *Cache) Stats() (int, int) {
 	return length, length * 48
 }
 
+// Files returns the name of every file in the cache, sorted.
+func (c *Cache) Files() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return slices.Sorted(maps.Keys(c.store))
+}
+
+// Check returns true when the file is in the cache and still has the size and mtime it was hashed with.
+// Entries from old cache files did not record them, they are trusted and take over size and modTime.
+// A file that changed is dropped from the cache so it is hashed again.
+func (c *Cache) Check(fileName string, size int64, modTime time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var img = c.store[fileName]
+	switch {
+	case img == nil:
+		return false
+	case img.Size == 0 && img.ModTime.IsZero():
+		img.Size, img.ModTime = size, modTime
+		return true
+	case img.Size == size && img.ModTime.Equal(modTime):
+		return true
+	}
+
+	delete(c.store, fileName)
+	return false
+}
+
+// Dimensions returns the width and height recorded when the file was hashed, ok is false when the file is
+// not cached, changed since or was cached by an older version that did not record them.
+func (c *Cache) Dimensions(fileName string, size int64, modTime time.Time) (int, int, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var img = c.store[fileName]
+	if img == nil || img.Width == 0 || img.Size != size || !img.ModTime.Equal(modTime) {
+		return 0, 0, false
+	}
+	return img.Width, img.Height, true
+}
+
 // GetHash gets the hash from cache or if it does not exist it calcs it
 func (c *Cache) GetHash(fileName string) (*Image, error) {
 
@@ -109,6 +191,21 @@ func (c *Cache) GetHash(fileName string) (*Image, error) {
 	}
 
 	c.imageCacheMisses.Inc()
+
+	var imgCache, err = HashFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.store[fileName] = imgCache
+	c.lock.Unlock()
+
+	return imgCache, nil
+}
+
+// HashFile decodes the image and calculates its perceptual hash without touching any cache.
+func HashFile(fileName string) (*Image, error) {
 	var imgCache = new(Image)
 
 	// #nosec G304: fileName is provided by caller and represents image path
@@ -117,10 +214,19 @@ func (c *Cache) GetHash(fileName string) (*Image, error) {
 	if err != nil {
 		return nil, fmt.Errorf("HashCache error opening file: %s, err: %w", fileName, err)
 	}
+	defer func() {
+		_ = fileHandle.Close() // read only, nothing to flush
+	}()
 
-	img, err := jpeg.Decode(fileHandle)
+	info, err := fileHandle.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("HashCache error decoding jpeg file: %s, err: %w", fileName, err)
+		return nil, fmt.Errorf("HashCache error stating file: %s, err: %w", fileName, err)
+	}
+	imgCache.Size, imgCache.ModTime = info.Size(), info.ModTime()
+
+	img, _, err := image.Decode(fileHandle)
+	if err != nil {
+		return nil, fmt.Errorf("HashCache error decoding image file: %s, err: %w", fileName, err)
 	}
 
 	imgCache.ImageHash, err = goimagehash.PerceptionHash(img)
@@ -133,17 +239,9 @@ func (c *Cache) GetHash(fileName string) (*Image, error) {
 		return nil, fmt.Errorf("HashCache error rewinding file: %s, err: %w", fileName, err)
 	}
 
-	imgCache.Config, err = jpeg.DecodeConfig(fileHandle)
+	imgCache.Config, _, err = image.DecodeConfig(fileHandle)
 	if err != nil {
-		return nil, fmt.Errorf("HashCache error decoding jpeg config file: %s, err: %w", fileName, err)
-	}
-
-	c.lock.Lock()
-	c.store[fileName] = imgCache
-	c.lock.Unlock()
-
-	if err = fileHandle.Close(); err != nil {
-		return nil, fmt.Errorf("HashCache error closing file: %s, err: %w", fileName, err)
+		return nil, fmt.Errorf("HashCache error decoding image config file: %s, err: %w", fileName, err)
 	}
 
 	return imgCache, nil
@@ -159,9 +257,9 @@ func (c *Cache) Persist() error {
 
 	// dump map to file
 	c.lock.Lock()
-	var m = make(map[string]uint64, len(c.store))
-	for file, hash := range c.store {
-		m[file] = hash.GetHash()
+	var m = make(map[string]cacheEntry, len(c.store))
+	for file, img := range c.store {
+		m[file] = cacheEntry{Hash: img.GetHash(), Size: img.Size, ModTime: img.ModTime, Width: img.Width, Height: img.Height}
 	}
 	c.lock.Unlock()
 
@@ -174,8 +272,12 @@ func (c *Cache) Persist() error {
 		return fmt.Errorf("HashCache error closing file: %s, err: %w", c.storeFileName, err)
 	}
 
-	prometheus.Unregister(c.imageCacheHits)
-	prometheus.Unregister(c.imageCacheMisses)
+	c.Unregister()
 
 	return nil
 }
+
+// Unregister removes the cache's metrics, Persist does this for you.
+func (c *Cache) Unregister() {
+	c.prom.Unregister(c.imageCacheHits, c.imageCacheMisses)
+}
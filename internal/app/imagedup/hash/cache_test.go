@@ -1,11 +1,16 @@
 package hash
 
 import (
+	"image"
+	"image/png"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/kmulvey/goutils"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
 	"github.com/kmulvey/path"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,7 +19,7 @@ func TestCache(t *testing.T) {
 
 	var cacheFile = "testcache.json"
 
-	var cache, err = NewCache(cacheFile, "TestCache", 3)
+	var cache, err = NewCache(cacheFile, metrics.Options{Registerer: prometheus.NewRegistry()}, 3)
 	assert.NoError(t, err)
 	assert.NotNil(t, cache)
 
@@ -36,7 +41,7 @@ func TestCache(t *testing.T) {
 	assert.NoError(t, err)
 
 	// do it again
-	cache, err = NewCache(cacheFile, "TestCache2", 3)
+	cache, err = NewCache(cacheFile, metrics.Options{Registerer: prometheus.NewRegistry()}, 3)
 	assert.NoError(t, err)
 	numImages, _ = cache.Stats()
 	assert.Equal(t, 3, numImages)
@@ -51,7 +56,7 @@ func TestBadCacheFile(t *testing.T) {
 	var cacheFile = "TestBadCacheFile.json"
 	assert.NoError(t, os.WriteFile(cacheFile, []byte("not json"), 0600))
 
-	var cache, err = NewCache(cacheFile, "TestBadCacheFile", 3)
+	var cache, err = NewCache(cacheFile, metrics.Options{}, 3)
 	assert.Equal(t, "HashCache error decoding json file: TestBadCacheFile.json, err: invalid character 'o' in literal null (expecting 'u')", err.Error())
 	assert.Nil(t, cache)
 
@@ -59,11 +64,85 @@ func TestBadCacheFile(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCacheCheck(t *testing.T) {
+	t.Parallel()
+
+	var cacheFile = filepath.Join(t.TempDir(), "cache.json")
+	var imageFile = filepath.Join(t.TempDir(), "iceland.jpg")
+	data, err := os.ReadFile("../testimages/iceland.jpg")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(imageFile, data, 0600))
+
+	// an old cache file only has the hashes
+	assert.NoError(t, os.WriteFile(cacheFile, []byte(`{"/old.jpg":42}`), 0600))
+	cache, err := NewCache(cacheFile, metrics.Options{Registerer: prometheus.NewRegistry()}, 2)
+	assert.NoError(t, err)
+	assert.True(t, cache.Check("/old.jpg", 10, time.Unix(100, 0)), "old entries are trusted")
+	assert.True(t, cache.Check("/old.jpg", 10, time.Unix(100, 0)))
+	assert.False(t, cache.Check(imageFile, 10, time.Unix(100, 0)), "not hashed yet")
+
+	img, err := cache.GetHash(imageFile)
+	assert.NoError(t, err)
+	info, err := os.Stat(imageFile)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), img.Size)
+	assert.NoError(t, cache.Persist())
+
+	// size, mtime and dimensions survive a round trip
+	cache, err = NewCache(cacheFile, metrics.Options{Registerer: prometheus.NewRegistry()}, 2)
+	assert.NoError(t, err)
+	assert.True(t, cache.Check(imageFile, info.Size(), info.ModTime()))
+	assert.True(t, cache.Check("/old.jpg", 10, time.Unix(100, 0)))
+	img, err = cache.GetHash(imageFile)
+	assert.NoError(t, err)
+	assert.Positive(t, img.Width*img.Height)
+	width, height, ok := cache.Dimensions(imageFile, info.Size(), info.ModTime())
+	assert.True(t, ok)
+	assert.Equal(t, [2]int{img.Width, img.Height}, [2]int{width, height})
+	_, _, ok = cache.Dimensions("/old.jpg", 10, time.Unix(100, 0))
+	assert.False(t, ok, "old entries did not record dimensions")
+
+	// a changed file is dropped so it is hashed again
+	assert.False(t, cache.Check(imageFile, info.Size(), info.ModTime().Add(time.Second)))
+	var numImages, _ = cache.Stats()
+	assert.Equal(t, 1, numImages)
+	assert.Equal(t, []string{"/old.jpg"}, cache.Files())
+}
+
+func TestHashFileFormats(t *testing.T) {
+	t.Parallel()
+
+	// a png that went through a jpeg round trip hashes like the jpeg
+	var src, err = os.Open("../testimages/iceland-small.jpg")
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, src.Close()) }()
+	img, _, err := image.Decode(src)
+	assert.NoError(t, err)
+
+	var pngFile = filepath.Join(t.TempDir(), "iceland-small") // no extension, the content decides
+	f, err := os.Create(pngFile)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, img))
+	assert.NoError(t, f.Close())
+
+	fromPNG, err := HashFile(pngFile)
+	assert.NoError(t, err)
+	fromJPEG, err := HashFile("../testimages/iceland-small.jpg")
+	assert.NoError(t, err)
+	distance, err := fromPNG.Distance(fromJPEG.ImageHash)
+	assert.NoError(t, err)
+	assert.Zero(t, distance)
+	assert.Equal(t, [2]int{fromJPEG.Width, fromJPEG.Height}, [2]int{fromPNG.Width, fromPNG.Height})
+
+	_, err = HashFile("cache_test.go")
+	assert.ErrorContains(t, err, "HashCache error decoding image file")
+}
+
 func BenchmarkGetHash(b *testing.B) {
 
 	var cacheFile = "testcache.json"
 
-	var cache, err = NewCache(cacheFile, goutils.RandomString(5), 3)
+	var cache, err = NewCache(cacheFile, metrics.Options{Registerer: prometheus.NewRegistry()}, 3)
 	assert.NoError(b, err)
 
 	dirs, err := path.List("../testimages", 1, false, path.NewFileEntitiesFilter())
@@ -2,11 +2,12 @@ package hash
 
 import (
 	"context"
-	"fmt"
 	"runtime"
 	"time"
 
 	"github.com/kmulvey/goutils"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
 	"github.com/kmulvey/imagedup/v2/pkg/imagedup/types"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -15,22 +16,51 @@ import (
 type Differ struct {
 	diffTime             prometheus.Gauge
 	comparisonsCompleted prometheus.Gauge
+	prom                 metrics.Options
 	inputImages          chan types.Pair
 	cache                *Cache
+	reference            *Cache // for the reference side of pairs, nil means cache
+	finished             func(row int)
 	numWorkers           int
 	distanceThreshold    int
 }
 
 // DiffResult are two images that are the "same", i.e. within the given distance
 type DiffResult struct {
-	One     string
-	Two     string
-	OneArea int
-	TwoArea int
+	One      string
+	Two      string
+	OneArea  int
+	TwoArea  int
+	OneHash  uint64
+	TwoHash  uint64
+	OneSize  int64     // of the file the hash was calculated from, see Image
+	TwoSize  int64     // of the file the hash was calculated from, see Image
+	OneMTime time.Time // of the file the hash was calculated from, see Image
+	TwoMTime time.Time // of the file the hash was calculated from, see Image
+	Distance int
+	Row      int  // row of the pair that was diffed, see types.Pair
+	TwoIsRef bool // Two is from a reference library and must be kept
+}
+
+// PairError is the error of a pair that could not be diffed, the pair is done once the caller has
+// handled the error, so a run that stops at the error does not count the pair as done.
+type PairError struct {
+	Row int // row of the pair, see types.Pair
+	Err error
+}
+
+// Error fulfils the error interface.
+func (e *PairError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the cause.
+func (e *PairError) Unwrap() error {
+	return e.Err
 }
 
 // NewDiffer is the constructor, Run() must be called to start diffing
-func NewDiffer(numWorkers, distanceThreshold int, inputImages chan types.Pair, cache *Cache, promNamespace string) *Differ {
+func NewDiffer(numWorkers, distanceThreshold int, inputImages chan types.Pair, cache *Cache, prom metrics.Options) (*Differ, error) {
 
 	if numWorkers <= 0 || numWorkers > runtime.GOMAXPROCS(0)-1 {
 		numWorkers = 1
@@ -41,28 +71,36 @@ func NewDiffer(numWorkers, distanceThreshold int, inputImages chan types.Pair, c
 		cache:             cache,
 		distanceThreshold: distanceThreshold,
 		numWorkers:        numWorkers,
-		diffTime: prometheus.NewGauge(
-			prometheus.GaugeOpts{
-				Namespace: promNamespace,
-				Name:      "diff_time_nano",
-				Help:      "How long it takes to diff two images, in nanoseconds.",
-			}),
-		comparisonsCompleted: prometheus.NewGauge(
-			prometheus.GaugeOpts{
-				Namespace: promNamespace,
-				Name:      "comparisons_completed",
-			}),
+		prom:              prom,
+	}
+
+	var err error
+	if d.diffTime, err = metrics.Register(prom, prom.Gauge("diff_time_nano", "How long it takes to diff two images, in nanoseconds.")); err != nil {
+		return nil, err
 	}
-	prometheus.MustRegister(d.diffTime)
-	prometheus.MustRegister(d.comparisonsCompleted)
+	if d.comparisonsCompleted, err = metrics.Register(prom, prom.Gauge("comparisons_completed", "How many comparisons have been done.")); err != nil {
+		prom.Unregister(d.diffTime)
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// OnFinished sets a func that is called with the row of every pair that was diffed without a result.
+// Pairs with a result or a PairError are only done once the caller has handled it.
+func (d *Differ) OnFinished(finished func(row int)) {
+	d.finished = finished
+}
 
-	return d
+// SetReferenceCache makes the differ look up the reference side of pairs in its own cache,
+// so the hashes of a reference library are kept apart from the ones of the files being deduped.
+func (d *Differ) SetReferenceCache(reference *Cache) {
+	d.reference = reference
 }
 
 // Shutdown unregisters prom stats
 func (d *Differ) Shutdown() {
-	prometheus.Unregister(d.diffTime)
-	prometheus.Unregister(d.comparisonsCompleted)
+	d.prom.Unregister(d.diffTime, d.comparisonsCompleted)
 }
 
 // Run starts the diff workers
@@ -109,24 +147,44 @@ func (d *Differ) diffWorker(ctx context.Context, results chan DiffResult, errors
 
 			imgCacheOne, err = d.cache.GetHash(p.One)
 			if err != nil {
-				errors <- fmt.Errorf("GetHash failed for image: %s, err: %w", p.One, err)
+				errors <- &PairError{Row: p.Row, Err: runerr.New(runerr.StageHash, p.One, err)}
 				continue
 			}
 
-			imgCacheTwo, err = d.cache.GetHash(p.Two)
+			if p.Reference && d.reference != nil {
+				imgCacheTwo, err = d.reference.GetHash(p.Two)
+			} else {
+				imgCacheTwo, err = d.cache.GetHash(p.Two)
+			}
 			if err != nil {
-				errors <- fmt.Errorf("GetHash failed for image: %s, err: %w", p.Two, err)
+				errors <- &PairError{Row: p.Row, Err: runerr.New(runerr.StageHash, p.Two, err)}
 				continue
 			}
 
 			distance, err = imgCacheOne.ImageHash.Distance(imgCacheTwo.ImageHash)
 			if err != nil {
-				errors <- fmt.Errorf("GetHash failed for image: %s, err: %w", p.Two, err)
+				errors <- &PairError{Row: p.Row, Err: runerr.New(runerr.StageCompare, p.One+" and "+p.Two, err)}
 				continue
 			}
 
 			if distance <= d.distanceThreshold {
-				results <- DiffResult{One: p.One, OneArea: imgCacheOne.Config.Height * imgCacheOne.Config.Width, Two: p.Two, TwoArea: imgCacheTwo.Config.Height * imgCacheTwo.Config.Width}
+				results <- DiffResult{
+					One:      p.One,
+					OneArea:  imgCacheOne.Config.Height * imgCacheOne.Config.Width,
+					OneHash:  imgCacheOne.GetHash(),
+					OneSize:  imgCacheOne.Size,
+					OneMTime: imgCacheOne.ModTime,
+					Two:      p.Two,
+					TwoArea:  imgCacheTwo.Config.Height * imgCacheTwo.Config.Width,
+					TwoHash:  imgCacheTwo.GetHash(),
+					TwoSize:  imgCacheTwo.Size,
+					TwoMTime: imgCacheTwo.ModTime,
+					Distance: distance,
+					Row:      p.Row,
+					TwoIsRef: p.Reference,
+				}
+			} else {
+				d.finish(p)
 			}
 
 			d.diffTime.Set(float64(time.Since(start)))
@@ -134,3 +192,10 @@ func (d *Differ) diffWorker(ctx context.Context, results chan DiffResult, errors
 		}
 	}
 }
+
+// finish reports a pair that has no result as done.
+func (d *Differ) finish(p types.Pair) {
+	if d.finished != nil {
+		d.finished(p.Row)
+	}
+}
@@ -3,9 +3,13 @@ package hash
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
+	"github.com/kmulvey/imagedup/v2/internal/app/runerr"
 	"github.com/kmulvey/imagedup/v2/pkg/imagedup/types"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,10 +19,11 @@ func TestDiffer(t *testing.T) {
 	var cacheFile = "testdiffer.json"
 	var inputImages = make(chan types.Pair)
 
-	var cache, err = NewCache(cacheFile, "testdiffer", 3)
+	var prom = metrics.Options{Registerer: prometheus.NewRegistry()}
+	var cache, err = NewCache(cacheFile, prom, 3)
 	assert.NoError(t, err)
 
-	var differ = NewDiffer(2, 10, inputImages, cache, "testdiffer")
+	differ, err := NewDiffer(2, 10, inputImages, cache, prom)
 	assert.NoError(t, err)
 
 	var results, errors = differ.Run(context.Background())
@@ -60,3 +65,29 @@ func TestDiffer(t *testing.T) {
 	err = os.RemoveAll(cacheFile)
 	assert.NoError(t, err)
 }
+
+func TestDifferError(t *testing.T) {
+	t.Parallel()
+
+	var inputImages = make(chan types.Pair, 1)
+	var prom = metrics.Options{Registerer: prometheus.NewRegistry()}
+	var cache, err = NewCache(filepath.Join(t.TempDir(), "cache.json"), prom, 2)
+	assert.NoError(t, err)
+	differ, err := NewDiffer(1, 10, inputImages, cache, prom)
+	assert.NoError(t, err)
+	differ.OnFinished(func(row int) {
+		assert.Fail(t, "a pair that failed is only done once its error was handled", "row %d", row)
+	})
+
+	var _, errors = differ.Run(context.Background())
+	inputImages <- types.Pair{One: "../testimages/iceland.jpg", Two: "../testimages/missing.jpg", Row: 4}
+	close(inputImages)
+
+	var pairErr *PairError
+	assert.ErrorAs(t, <-errors, &pairErr)
+	assert.Equal(t, 4, pairErr.Row)
+	var runErr *runerr.Error
+	assert.ErrorAs(t, pairErr, &runErr)
+	assert.Equal(t, "../testimages/missing.jpg", runErr.Path)
+	differ.Shutdown()
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
 	"github.com/kmulvey/imagedup/v2/pkg/imagedup/types"
 )
 
@@ -23,12 +24,14 @@ type ImageDup struct {
 	HashCache  *hash.Cache
 	dedupCache map[string]struct{}
 	images     chan types.Pair
+	progress   *progress
 	dedupPairs bool
 	bitmapLock sync.RWMutex
 }
 
 // NewImageDup is the constructor which sets up everything for diffing but does not actually start diffing, Run() must be called for that.
-func NewImageDup(promNamespace, hashCacheFile string, numWorkers, numFiles, distanceThreshold int, dedupPairs bool) (*ImageDup, error) {
+// Every metric is registered with prom, give each instance that is alive at the same time its own registerer or const labels.
+func NewImageDup(prom metrics.Options, hashCacheFile string, numWorkers, numFiles, distanceThreshold int, dedupPairs bool) (*ImageDup, error) {
 	if numFiles < 2 {
 		return nil, fmt.Errorf("%w: only %d files provided", ErrInsufficientFiles, numFiles)
 	}
@@ -37,18 +40,27 @@ func NewImageDup(promNamespace, hashCacheFile string, numWorkers, numFiles, dist
 	var err error
 
 	id.images = make(chan types.Pair)
-	id.stats = newStats(promNamespace)
+	if id.stats, err = newStats(prom); err != nil {
+		return nil, fmt.Errorf("failed to register stats (namespace: %s): %w", prom.Namespace, err)
+	}
 	id.dedupPairs = dedupPairs
 	if dedupPairs {
 		id.dedupCache = make(map[string]struct{}, numFiles)
 	}
 
-	id.HashCache, err = hash.NewCache(hashCacheFile, promNamespace, numFiles)
+	// the cache="files" label sets its metrics apart from the ones of a reference library cache, see scan -against-cache
+	id.HashCache, err = hash.NewCache(hashCacheFile, prom.With("cache", "files"), numFiles)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create hash cache (file: %s, namespace: %s, numFiles: %d): %w", hashCacheFile, promNamespace, numFiles, err)
+		id.stats.unregister()
+		return nil, fmt.Errorf("failed to create hash cache (file: %s, namespace: %s, numFiles: %d): %w", hashCacheFile, prom.Namespace, numFiles, err)
 	}
 
-	id.Differ = hash.NewDiffer(numWorkers, distanceThreshold, id.images, id.HashCache, promNamespace)
+	id.Differ, err = hash.NewDiffer(numWorkers, distanceThreshold, id.images, id.HashCache, prom)
+	if err != nil {
+		id.stats.unregister()
+		id.HashCache.Unregister()
+		return nil, fmt.Errorf("failed to create differ (namespace: %s): %w", prom.Namespace, err)
+	}
 
 	go id.stats.publishStats(id.HashCache, id.dedupCache, dedupPairs, &id.bitmapLock)
 
@@ -57,11 +69,67 @@ func NewImageDup(promNamespace, hashCacheFile string, numWorkers, numFiles, dist
 
 // Run starts the diff workers and feeds them files.
 func (id *ImageDup) Run(ctx context.Context, files []string) (chan hash.DiffResult, chan error) {
+	return id.RunFrom(ctx, files, 0)
+}
+
+// RunFrom is Run for a run that was interrupted, the pairs whose first image is before files[firstRow]
+// are not compared again. firstRow is usually the RowsDone of the interrupted run and files must be
+// the same list in the same order.
+func (id *ImageDup) RunFrom(ctx context.Context, files []string, firstRow int) (chan hash.DiffResult, chan error) {
+	id.progress = newProgress(len(files), firstRow)
+	id.Differ.OnFinished(id.progress.finished)
+
 	var results, errors = id.Differ.Run(ctx)
-	go id.streamFiles(ctx, files)
+	go id.streamFiles(ctx, files, firstRow, id.progress)
 	return results, errors
 }
 
+// RunIncremental is Run for a library that was deduped before, only the new files are compared to
+// every file, including the other new files. newFiles must be a subset of files, firstRow is the
+// RowsDone of an interrupted incremental run with the same new files.
+func (id *ImageDup) RunIncremental(ctx context.Context, files, newFiles []string, firstRow int) (chan hash.DiffResult, chan error) {
+	id.progress = newProgress(len(newFiles), firstRow)
+	id.Differ.OnFinished(id.progress.finished)
+
+	var results, errors = id.Differ.Run(ctx)
+	go id.streamNewFiles(ctx, files, newFiles, firstRow, id.progress)
+	return results, errors
+}
+
+// RunAgainst compares the files to a reference library only, pairs of two files or of two reference
+// images are not compared. The reference side of every result is flagged so it is never deleted,
+// see SetReferenceCache to keep its hashes in another cache. firstRow is the RowsDone of an interrupted run.
+func (id *ImageDup) RunAgainst(ctx context.Context, files, reference []string, firstRow int) (chan hash.DiffResult, chan error) {
+	id.progress = newProgress(len(files), firstRow)
+	id.Differ.OnFinished(id.progress.finished)
+
+	var results, errors = id.Differ.Run(ctx)
+	go id.streamAgainst(ctx, files, reference, firstRow, id.progress)
+	return results, errors
+}
+
+// Handled tells the progress tracking the result was handled, e.g. written to the delete log.
+// Only callers that checkpoint with RowsDone need to call it.
+func (id *ImageDup) Handled(result hash.DiffResult) {
+	id.progress.finished(result.Row)
+}
+
+// HandledError is Handled for an error of the run, e.g. recorded in the error report. Until then the
+// pair it failed is not done, so a run that stops at the error compares the pair again when resumed.
+func (id *ImageDup) HandledError(err error) {
+	var pairErr *hash.PairError
+	if errors.As(err, &pairErr) {
+		id.progress.finished(pairErr.Row)
+	}
+}
+
+// RowsDone returns how many files from the start of the list, or of the new files for RunIncremental, have
+// been compared to every other file with every result handled. A run restarted at this row picks up where
+// this one stopped.
+func (id *ImageDup) RowsDone() int {
+	return id.progress.rowsDone()
+}
+
 // Shutdown unregisters prom stats and writes the image cache to disk. Context cancel must be called to
 // kill the differ workers. See nsquared/main.go for an example.
 func (id *ImageDup) Shutdown() error {
@@ -4,7 +4,9 @@ import (
 	"os"
 	"testing"
 
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
 	"github.com/kmulvey/path"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,11 +15,11 @@ func TestNewImageDup(t *testing.T) {
 
 	var cacheFile = "TestNewImageDup.json"
 
-	var dup, err = NewImageDup("TestNewImageDup", cacheFile, 2, 1, 10, true)
+	var dup, err = NewImageDup(metrics.Options{}, cacheFile, 2, 1, 10, true)
 	assert.Equal(t, "insufficient files to process: only 1 files provided", err.Error())
 	assert.Nil(t, dup)
 
-	dup, err = NewImageDup("TestNewImageDup", cacheFile, 2, 3, 10, true)
+	dup, err = NewImageDup(metrics.Options{Registerer: prometheus.NewRegistry()}, cacheFile, 2, 3, 10, true)
 	assert.NoError(t, err)
 
 	dirs, err := path.List("./testimages", 1, false, path.NewFileEntitiesFilter())
@@ -43,6 +45,7 @@ func TestNewImageDup(t *testing.T) {
 					continue
 				}
 				assert.Contains(t, diff.One, "iceland")
+				dup.Handled(diff)
 				i++
 			}
 		}
@@ -50,6 +53,7 @@ func TestNewImageDup(t *testing.T) {
 	}()
 
 	<-done
+	assert.Equal(t, len(fileNames), dup.RowsDone())
 
 	assert.NoError(t, dup.Shutdown())
 
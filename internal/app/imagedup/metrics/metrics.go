@@ -0,0 +1,73 @@
+// Package metrics holds the prometheus options shared by everything in imagedup that publishes metrics,
+// so several ImageDup instances can live in one process without fighting over the default registry.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options says where and how metrics are registered. The zero value registers them on the default
+// registry without a namespace or labels.
+type Options struct {
+	// Registerer is where the metrics are registered, nil means prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// Namespace is prefixed to every metric name.
+	Namespace string
+	// ConstLabels are added to every metric, use them to tell apart instances sharing a registerer.
+	ConstLabels prometheus.Labels
+}
+
+// registerer returns the registerer to use.
+func (o Options) registerer() prometheus.Registerer {
+	if o.Registerer == nil {
+		return prometheus.DefaultRegisterer
+	}
+	return o.Registerer
+}
+
+// With returns the options with another const label, e.g. to tell apart the hash caches of one instance.
+func (o Options) With(name, value string) Options {
+	var labels = make(prometheus.Labels, len(o.ConstLabels)+1)
+	maps.Copy(labels, o.ConstLabels)
+	labels[name] = value
+	o.ConstLabels = labels
+	return o
+}
+
+// Gauge creates a gauge with the namespace and labels of the options, it still needs to be registered.
+func (o Options) Gauge(name, help string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{Namespace: o.Namespace, Name: name, Help: help, ConstLabels: o.ConstLabels})
+}
+
+// Counter creates a counter with the namespace and labels of the options, it still needs to be registered.
+func (o Options) Counter(name, help string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Namespace: o.Namespace, Name: name, Help: help, ConstLabels: o.ConstLabels})
+}
+
+// Register registers the collector. If an identical collector is already registered, e.g. because an
+// earlier instance was never shut down, the existing one is returned instead of failing.
+func Register[T prometheus.Collector](o Options, collector T) (T, error) {
+	var err = o.registerer().Register(collector)
+	if err == nil {
+		return collector, nil
+	}
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		if existing, ok := alreadyRegistered.ExistingCollector.(T); ok {
+			return existing, nil
+		}
+	}
+	return collector, fmt.Errorf("unable to register prometheus collector, err: %w", err)
+}
+
+// Unregister removes the collectors, collectors that were never registered are ignored.
+func (o Options) Unregister(collectors ...prometheus.Collector) {
+	for _, collector := range collectors {
+		o.registerer().Unregister(collector)
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// series returns how many time series the registry has, and the sum of their counters.
+func series(t *testing.T, registry *prometheus.Registry) (int, float64) {
+	t.Helper()
+
+	var families, err = registry.Gather()
+	assert.NoError(t, err)
+
+	var n int
+	var sum float64
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			n++
+			sum += metric.GetCounter().GetValue()
+		}
+	}
+	return n, sum
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	var registry = prometheus.NewRegistry()
+	var one = Options{Registerer: registry, Namespace: "test", ConstLabels: prometheus.Labels{"worker": "1"}}
+	var two = Options{Registerer: registry, Namespace: "test", ConstLabels: prometheus.Labels{"worker": "2"}}
+
+	var counterOne, err = Register(one, one.Counter("pairs", "help"))
+	assert.NoError(t, err)
+	counterTwo, err := Register(two, two.Counter("pairs", "help"))
+	assert.NoError(t, err, "const labels tell instances apart")
+	counterOne.Inc()
+	var n, _ = series(t, registry)
+	assert.Equal(t, 2, n)
+
+	// an instance that was never shut down does not stop the next one
+	again, err := Register(one, one.Counter("pairs", "help"))
+	assert.NoError(t, err)
+	again.Inc()
+	_, sum := series(t, registry)
+	assert.InDelta(t, 2, sum, 0, "the existing counter is reused")
+
+	// same name, different type
+	_, err = Register(one, one.Gauge("pairs", "help"))
+	assert.Error(t, err)
+
+	// the caches of an instance are told apart by a label of their own
+	var cache = one.With("cache", "reference")
+	assert.Equal(t, prometheus.Labels{"worker": "1", "cache": "reference"}, cache.ConstLabels)
+	assert.Equal(t, prometheus.Labels{"worker": "1"}, one.ConstLabels, "the labels are copied")
+
+	one.Unregister(counterOne)
+	two.Unregister(counterTwo)
+	n, _ = series(t, registry)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,51 @@
+package imagedup
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// progress tracks which rows of the pair stream are done, a row being every pair whose first image is
+// files[row]. A row is done once all of its pairs were streamed and diffed and every result was handled
+// by the caller, so a run restarted at RowsDone never loses a result.
+type progress struct {
+	pending  []atomic.Int64 // pairs of each row that were streamed but are not done yet
+	streamed atomic.Int64   // rows before this one have been streamed completely
+	done     int            // rows before this one are done
+	lock     sync.Mutex     // guards done
+}
+
+// newProgress starts tracking at firstRow, the rows before it were done in an earlier run.
+func newProgress(numFiles, firstRow int) *progress {
+	var p = &progress{pending: make([]atomic.Int64, numFiles), done: firstRow}
+	p.streamed.Store(int64(firstRow))
+	return p
+}
+
+// sent is called before a pair of the row is streamed.
+func (p *progress) sent(row int) {
+	p.pending[row].Add(1)
+}
+
+// rowStreamed is called once every pair of the row was streamed.
+func (p *progress) rowStreamed(row int) {
+	p.streamed.Store(int64(row + 1))
+}
+
+// finished is called once a pair of the row is done.
+func (p *progress) finished(row int) {
+	p.pending[row].Add(-1)
+}
+
+// rowsDone returns the number of rows from the start of the files that are done.
+func (p *progress) rowsDone() int {
+	var streamed = int(p.streamed.Load())
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for p.done < streamed && p.pending[p.done].Load() == 0 {
+		p.done++
+	}
+	return p.done
+}
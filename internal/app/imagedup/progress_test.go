@@ -0,0 +1,29 @@
+package imagedup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+
+	var p = newProgress(4, 1)
+	assert.Equal(t, 1, p.rowsDone())
+
+	p.sent(1)
+	p.sent(1)
+	p.rowStreamed(1)
+	p.sent(2)
+	assert.Equal(t, 1, p.rowsDone(), "row 1 has pairs in flight")
+
+	p.finished(1)
+	p.finished(1)
+	assert.Equal(t, 2, p.rowsDone(), "row 2 is still streaming")
+
+	p.rowStreamed(2)
+	assert.Equal(t, 2, p.rowsDone())
+	p.finished(2)
+	assert.Equal(t, 3, p.rowsDone())
+}
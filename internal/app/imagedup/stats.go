@@ -7,6 +7,7 @@ import (
 	"unsafe"
 
 	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -22,101 +23,59 @@ type stats struct {
 	FileMapEntries      prometheus.Gauge
 	FileMapHits         prometheus.Counter
 	FileMapMisses       prometheus.Counter
-	PromNamespace       string
+	prom                metrics.Options
+	stop                chan struct{}
 }
 
-// newStats inits all the stats.
-// nolint: funlen
-func newStats(promNamespace string) *stats {
+// newStats inits and registers all the stats, if any fail to register the ones that did are unregistered.
+func newStats(prom metrics.Options) (*stats, error) {
 	var s = new(stats)
-	s.PromNamespace = promNamespace
+	s.prom = prom
+	s.stop = make(chan struct{})
 
-	s.GCTime = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Namespace: promNamespace,
-			Name:      "gc_time_nano",
-			Help:      "how long a gc sweep took",
-		},
-	)
-	s.TotalComparisons = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Namespace: promNamespace,
-			Name:      "total_comparisons",
-			Help:      "how many comparisons need to be done",
-		},
-	)
-	s.TotalFiles = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Namespace: promNamespace,
-			Name:      "total_files",
-			Help:      "how many files we were give to compare",
-		},
-	)
-	s.PairTotal = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Namespace: promNamespace,
-			Name:      "pair_total",
-			Help:      "How many pairs we read.",
-		},
-	)
-	s.ImageCacheBytes = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Namespace: promNamespace,
-			Name:      "image_cache_size_bytes",
-			Help:      "disk size of the cache",
-		},
-	)
-	s.ImageCacheNumImages = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Namespace: promNamespace,
-			Name:      "image_cache_num_images",
-			Help:      "how many images are in the cache",
-		},
-	)
-	s.FileMapBytes = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Namespace: promNamespace,
-			Name:      "file_map_bytes",
-			Help:      "size of the file dedup map",
-		},
-	)
-	s.FileMapEntries = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Namespace: promNamespace,
-			Name:      "file_map_entries",
-			Help:      "number of entries in the file dedup map",
-		},
-	)
-	s.FileMapHits = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Namespace: promNamespace,
-			Name:      "file_map_hits",
-			Help:      "number of entries in the file dedup map",
-		},
-	)
-	s.FileMapMisses = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Namespace: promNamespace,
-			Name:      "file_map_misses",
-			Help:      "number of entries in the file dedup map",
-		},
-	)
-	prometheus.MustRegister(s.PairTotal)
-	prometheus.MustRegister(s.GCTime)
-	prometheus.MustRegister(s.TotalComparisons)
-	prometheus.MustRegister(s.TotalFiles)
-	prometheus.MustRegister(s.ImageCacheBytes)
-	prometheus.MustRegister(s.ImageCacheNumImages)
-	prometheus.MustRegister(s.FileMapBytes)
-	prometheus.MustRegister(s.FileMapEntries)
-	prometheus.MustRegister(s.FileMapHits)
-	prometheus.MustRegister(s.FileMapMisses)
+	var gauges = []struct {
+		gauge      *prometheus.Gauge
+		name, help string
+	}{
+		{&s.GCTime, "gc_time_nano", "how long a gc sweep took"},
+		{&s.TotalComparisons, "total_comparisons", "how many comparisons need to be done"},
+		{&s.TotalFiles, "total_files", "how many files we were give to compare"},
+		{&s.ImageCacheBytes, "image_cache_size_bytes", "disk size of the cache"},
+		{&s.ImageCacheNumImages, "image_cache_num_images", "how many images are in the cache"},
+		{&s.FileMapBytes, "file_map_bytes", "size of the file dedup map"},
+		{&s.FileMapEntries, "file_map_entries", "number of entries in the file dedup map"},
+	}
+	var counters = []struct {
+		counter    *prometheus.Counter
+		name, help string
+	}{
+		{&s.PairTotal, "pair_total", "How many pairs we read."},
+		{&s.FileMapHits, "file_map_hits", "number of pairs already in the file dedup map"},
+		{&s.FileMapMisses, "file_map_misses", "number of pairs not yet in the file dedup map"},
+	}
 
-	return s
+	var err error
+	for _, g := range gauges {
+		if *g.gauge, err = metrics.Register(prom, prom.Gauge(g.name, g.help)); err != nil {
+			s.unregister()
+			return nil, err
+		}
+	}
+	for _, c := range counters {
+		if *c.counter, err = metrics.Register(prom, prom.Counter(c.name, c.help)); err != nil {
+			s.unregister()
+			return nil, err
+		}
+	}
+
+	return s, nil
 }
 
-// publishStats publishes go GC stats + cache size to prom every 10 seconds.
+// publishStats publishes go GC stats + cache size to prom every 10 seconds until the stats are unregistered.
 func (s *stats) publishStats(imageCache *hash.Cache, dedupMap map[string]struct{}, dedupPairs bool, bitmapLock *sync.RWMutex) {
+	var ticker = time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
 	for {
 		var stats runtime.MemStats
 		runtime.ReadMemStats(&stats)
@@ -134,20 +93,21 @@ func (s *stats) publishStats(imageCache *hash.Cache, dedupMap map[string]struct{
 			bitmapLock.Unlock()
 		}
 
-		time.Sleep(10 * time.Second)
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
-// unregister removes all the stats.
+// unregister removes all the stats and stops publishing them.
 func (s *stats) unregister() {
-	prometheus.Unregister(s.PairTotal)
-	prometheus.Unregister(s.GCTime)
-	prometheus.Unregister(s.TotalComparisons)
-	prometheus.Unregister(s.TotalFiles)
-	prometheus.Unregister(s.ImageCacheBytes)
-	prometheus.Unregister(s.ImageCacheNumImages)
-	prometheus.Unregister(s.FileMapBytes)
-	prometheus.Unregister(s.FileMapEntries)
-	prometheus.Unregister(s.FileMapHits)
-	prometheus.Unregister(s.FileMapMisses)
+	close(s.stop)
+	for _, c := range []prometheus.Collector{s.PairTotal, s.GCTime, s.TotalComparisons, s.TotalFiles, s.ImageCacheBytes,
+		s.ImageCacheNumImages, s.FileMapBytes, s.FileMapEntries, s.FileMapHits, s.FileMapMisses} {
+		if c != nil {
+			s.prom.Unregister(c)
+		}
+	}
 }
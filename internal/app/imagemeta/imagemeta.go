@@ -0,0 +1,237 @@
+// Package imagemeta reads the facts about an image file that help a human decide which of two
+// duplicates to keep: dimensions, format, jpeg quality and the camera that took it.
+package imagemeta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// errNotJPEG is returned when parsing jpeg segments of something else.
+var errNotJPEG = errors.New("not a jpeg")
+
+// exifTimeLayout is the format of the date/time tags in EXIF.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// Metadata is everything we know about an image. Zero values mean unknown.
+type Metadata struct {
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	Format   string
+	Width    int
+	Height   int
+	Quality  int // jpeg quality estimated from the quantization tables, 1-100
+	Camera   string
+	Captured time.Time
+}
+
+// Read reads the metadata of an image. Only the headers are read, the image is not decoded.
+// A file that is not an image still returns its size and mtime along with the error.
+func Read(fileName string) (Metadata, error) {
+	var m = Metadata{Path: fileName}
+
+	// #nosec G304: fileName is an image path given to us by the caller.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return m, fmt.Errorf("unable to open file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only, nothing to flush
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return m, fmt.Errorf("unable to stat file: %s, err: %w", fileName, err)
+	}
+	m.Size = info.Size()
+	m.ModTime = info.ModTime()
+
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return m, fmt.Errorf("unable to decode image config: %s, err: %w", fileName, err)
+	}
+	m.Width, m.Height, m.Format = config.Width, config.Height, format
+
+	if format == "jpeg" {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return m, fmt.Errorf("unable to rewind file: %s, err: %w", fileName, err)
+		}
+		if err := m.readJPEGSegments(bufio.NewReader(f)); err != nil {
+			return m, fmt.Errorf("unable to read jpeg segments: %s, err: %w", fileName, err)
+		}
+	}
+
+	return m, nil
+}
+
+// readJPEGSegments walks the jpeg markers up to the start of scan looking for EXIF and the quantization tables.
+func (m *Metadata) readJPEGSegments(r *bufio.Reader) error {
+	var soi = make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil {
+		return err
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return errNotJPEG
+	}
+
+	for {
+		var header = make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		if header[0] != 0xFF {
+			return fmt.Errorf("%w: bad marker %x", errNotJPEG, header[:2])
+		}
+
+		var marker = header[1]
+		if marker == 0xDA { // start of scan, everything we want comes before this
+			return nil
+		}
+
+		var length = int(binary.BigEndian.Uint16(header[2:])) - 2
+		if length < 0 {
+			return fmt.Errorf("%w: bad segment length", errNotJPEG)
+		}
+		var segment = make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return err
+		}
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			m.readExif(segment[6:])
+		case marker == 0xDB && m.Quality == 0:
+			m.Quality = estimateQuality(segment)
+		}
+	}
+}
+
+// stdLuminance is the quantization table from Annex K of the jpeg spec, libjpeg scales it to get each quality.
+var stdLuminance = [64]float64{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// estimateQuality reverses the libjpeg quality scaling of the first (luminance) table in a DQT segment.
+// The order of the values does not matter as we compare sums, so zigzag order can be ignored.
+func estimateQuality(dqt []byte) int {
+	if len(dqt) < 1 {
+		return 0
+	}
+
+	var precision = dqt[0] >> 4
+	var table = dqt[1:]
+	var sum, stdSum float64
+	for i := range 64 {
+		switch {
+		case precision == 0 && i < len(table):
+			sum += float64(table[i])
+		case precision == 1 && 2*i+1 < len(table):
+			sum += float64(binary.BigEndian.Uint16(table[2*i:]))
+		default:
+			return 0
+		}
+		stdSum += stdLuminance[i]
+	}
+
+	var scale = sum / stdSum * 100
+	var quality float64
+	if scale <= 100 {
+		quality = (200 - scale) / 2
+	} else {
+		quality = 5000 / scale
+	}
+	return int(math.Max(1, math.Min(100, math.Round(quality))))
+}
+
+// readExif pulls the camera and capture date out of a TIFF structured EXIF block. Anything malformed is ignored.
+func (m *Metadata) readExif(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	var tags = readIFD(tiff, order, order.Uint32(tiff[4:]))
+	var cameraMake, model = tags[0x010F], tags[0x0110]
+	if strings.HasPrefix(model, cameraMake) { // most cameras repeat the make in the model
+		m.Camera = model
+	} else {
+		m.Camera = strings.TrimSpace(cameraMake + " " + model)
+	}
+
+	var captured = tags[0x0132] // DateTime, used when there is no DateTimeOriginal
+	if exifOffset, found := tags[0x8769]; found && len(exifOffset) == 4 {
+		var exifTags = readIFD(tiff, order, order.Uint32([]byte(exifOffset)))
+		if original, found := exifTags[0x9003]; found {
+			captured = original
+		}
+	}
+	if t, err := time.Parse(exifTimeLayout, captured); err == nil {
+		m.Captured = t
+	}
+}
+
+// readIFD returns the ascii tags of an IFD, and the raw offset of the EXIF sub IFD.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16]string {
+	var tags = make(map[uint16]string)
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return tags
+	}
+
+	var count = int(order.Uint16(tiff[offset:]))
+	for i := range count {
+		var entryStart = int(offset) + 2 + i*12
+		if entryStart+12 > len(tiff) {
+			break
+		}
+		var entry = tiff[entryStart : entryStart+12]
+		var tag, kind, n = order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:])
+
+		switch {
+		case tag == 0x8769:
+			tags[tag] = string(entry[8:12])
+		case kind == 2: // ascii
+			var value = entry[8:12]
+			if n > 4 {
+				var valueOffset = order.Uint32(entry[8:])
+				if uint64(valueOffset)+uint64(n) > uint64(len(tiff)) {
+					continue
+				}
+				value = tiff[valueOffset : valueOffset+n]
+			} else {
+				value = value[:n]
+			}
+			tags[tag] = strings.TrimRight(string(value), "\x00 ")
+		}
+	}
+
+	return tags
+}
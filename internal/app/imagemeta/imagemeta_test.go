@@ -0,0 +1,51 @@
+package imagemeta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	var m, err = Read("../imagedup/testimages/iceland.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", m.Format)
+	assert.Equal(t, 640, m.Width)
+	assert.Equal(t, 426, m.Height)
+	assert.Equal(t, int64(83444), m.Size)
+	assert.Equal(t, "Canon EOS 5D Mark II", m.Camera)
+	assert.Equal(t, time.Date(2014, 6, 30, 10, 20, 31, 0, time.UTC), m.Captured)
+	assert.Equal(t, 92, m.Quality)
+
+	m, err = Read("../imagedup/testimages/trees.jpg")
+	assert.NoError(t, err)
+	assert.Empty(t, m.Camera)
+	assert.True(t, m.Captured.IsZero())
+	assert.Positive(t, m.Quality)
+
+	m, err = Read("imagemeta.go")
+	assert.Error(t, err)
+	assert.Positive(t, m.Size, "size is known even if it is not an image")
+}
+
+func TestEstimateQuality(t *testing.T) {
+	t.Parallel()
+
+	// libjpeg tables at quality 50 are the standard table itself
+	var dqt = make([]byte, 65)
+	for i, q := range stdLuminance {
+		dqt[i+1] = byte(q)
+	}
+	assert.Equal(t, 50, estimateQuality(dqt))
+
+	// quality 100 is all ones
+	for i := range 64 {
+		dqt[i+1] = 1
+	}
+	assert.Equal(t, 99, estimateQuality(dqt))
+
+	assert.Equal(t, 0, estimateQuality(dqt[:10]))
+}
@@ -0,0 +1,196 @@
+// Package manifest names the per dir output files written by uniqdirs and records which source dir
+// each of them belongs to, so dirs with the same name in different places never share a cache or log.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FileName is the name of the manifest inside the output dir.
+const FileName = "manifest.json"
+
+// maxSlugLength keeps the file names well under the 255 byte limit of most file systems.
+const maxSlugLength = 64
+
+// Entry is the output files of a single source dir.
+type Entry struct {
+	Dir         string    `json:"dir"`
+	Cache       string    `json:"cache_file"`
+	DeleteLog   string    `json:"delete_file,omitempty"` // empty when no duplicates were found
+	Fingerprint string    `json:"fingerprint,omitempty"` // set once the dir was deduped completely
+	Updated     time.Time `json:"updated"`
+}
+
+// FileState is what the fingerprint of a dir is made of for each of its files.
+type FileState struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Manifest maps every source dir processed into an output dir to its files.
+type Manifest struct {
+	FileName string  `json:"-"`
+	Entries  []Entry `json:"dirs"`
+}
+
+// Slug returns a file name safe, collision free name for a dir: the readable tail of the path
+// followed by a hash of the whole absolute path, e.g. photos-2019-misc-3f9a1c0b.
+func Slug(dir string) string {
+	var abs, err = filepath.Abs(dir)
+	if err != nil {
+		abs = filepath.Clean(dir)
+	}
+	var sum = sha256.Sum256([]byte(abs))
+
+	var slug strings.Builder
+	var dash bool
+	for _, r := range strings.ToLower(abs) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug.WriteRune(r)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+
+	var readable = strings.TrimSuffix(slug.String(), "-")
+	if len(readable) > maxSlugLength { // keep the end, it is the part that tells dirs apart
+		readable = strings.TrimPrefix(readable[len(readable)-maxSlugLength:], "-")
+	}
+	if readable == "" {
+		readable = "root"
+	}
+
+	return readable + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Fingerprint identifies the files a dir was deduped with and the distance used to compare them. A dir
+// whose files were added, removed or changed, or that is compared with another distance, gets a new fingerprint.
+func Fingerprint(distanceThreshold int, files []FileState) string {
+	var sorted = slices.SortedFunc(slices.Values(files), func(a, b FileState) int { return strings.Compare(a.Path, b.Path) })
+
+	var sum = sha256.New()
+	fmt.Fprintf(sum, "distance %d\n", distanceThreshold)
+	for _, file := range sorted {
+		fmt.Fprintf(sum, "%s\x00%d\x00%d\n", file.Path, file.Size, file.ModTime.UnixNano())
+	}
+	return hex.EncodeToString(sum.Sum(nil)[:16])
+}
+
+// Open reads the manifest in the output dir, a missing manifest is an empty one.
+func Open(outputDir string) (*Manifest, error) {
+	var m, err = Read(filepath.Join(outputDir, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{FileName: filepath.Join(outputDir, FileName)}, nil
+	}
+	return m, err
+}
+
+// Read reads a manifest file.
+func Read(fileName string) (*Manifest, error) {
+	// #nosec G304: fileName is given to us by the user.
+	var data, err = os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifest: %s, err: %w", fileName, err)
+	}
+
+	var m = &Manifest{FileName: fileName}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal manifest: %s, err: %w", fileName, err)
+	}
+	return m, nil
+}
+
+// Files returns the entry for a dir, the names only depend on the dir so every run reuses the same files.
+// The file names are absolute paths in the output dir.
+func (m *Manifest) Files(dir string) Entry {
+	var abs, err = filepath.Abs(dir)
+	if err != nil {
+		abs = filepath.Clean(dir)
+	}
+
+	var outputDir, _ = filepath.Abs(filepath.Dir(m.FileName))
+	var slug = Slug(abs)
+	return Entry{
+		Dir:       abs,
+		Cache:     filepath.Join(outputDir, slug+".json"),
+		DeleteLog: filepath.Join(outputDir, slug+"-delete.json"),
+	}
+}
+
+// Set adds or replaces the entry for its dir.
+func (m *Manifest) Set(entry Entry) {
+	entry.Updated = time.Now()
+	if i := slices.IndexFunc(m.Entries, func(e Entry) bool { return e.Dir == entry.Dir }); i >= 0 {
+		m.Entries[i] = entry
+		return
+	}
+	m.Entries = append(m.Entries, entry)
+}
+
+// Done returns true when the dir was deduped completely with the same fingerprint and its cache is still there,
+// so a run that was interrupted can skip it.
+func (m *Manifest) Done(dir, fingerprint string) bool {
+	var entry = m.Files(dir)
+	var i = slices.IndexFunc(m.Entries, func(e Entry) bool { return e.Dir == entry.Dir })
+	if i < 0 || m.Entries[i].Fingerprint == "" || m.Entries[i].Fingerprint != fingerprint {
+		return false
+	}
+	if _, err := os.Stat(m.Entries[i].Cache); err != nil {
+		return false
+	}
+	if deleteLog := m.Entries[i].DeleteLog; deleteLog != "" {
+		if _, err := os.Stat(deleteLog); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Forget removes the entry for the dir and returns true if there was one. It is called before a dir is
+// deduped again so an interrupted run never leaves it marked as done with a half written delete log.
+func (m *Manifest) Forget(dir string) bool {
+	var abs = m.Files(dir).Dir
+	var before = len(m.Entries)
+	m.Entries = slices.DeleteFunc(m.Entries, func(e Entry) bool { return e.Dir == abs })
+	return len(m.Entries) != before
+}
+
+// DeleteLogs returns every delete log in the manifest.
+func (m *Manifest) DeleteLogs() []string {
+	var logs []string
+	for _, entry := range m.Entries {
+		if entry.DeleteLog != "" {
+			logs = append(logs, entry.DeleteLog)
+		}
+	}
+	return logs
+}
+
+// Write saves the manifest, it is written to a temp file first so an interrupted run never leaves half a manifest.
+func (m *Manifest) Write() error {
+	var data, err = json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal manifest, err: %w", err)
+	}
+
+	var tmp = m.FileName + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write manifest: %s, err: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, m.FileName); err != nil {
+		return fmt.Errorf("unable to rename manifest: %s, err: %w", tmp, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlug(t *testing.T) {
+	t.Parallel()
+
+	var a, b = Slug("/photos/2019/misc"), Slug("/photos/2020/misc")
+	assert.NotEqual(t, a, b)
+	assert.True(t, strings.HasPrefix(a, "photos-2019-misc-"), a)
+	assert.Len(t, a, len("photos-2019-misc-")+8)
+	assert.Equal(t, a, Slug("/photos/2019/misc/"))
+	assert.True(t, strings.HasPrefix(Slug("/"), "root-"))
+
+	var long = Slug("/" + strings.Repeat("very long dir name/", 10) + "Ünïcode Holiday")
+	assert.LessOrEqual(t, len(long), maxSlugLength+9)
+	assert.True(t, strings.HasPrefix(long, "ng-dir-name-very-long"), "the end of the path is kept: %s", long)
+	assert.Contains(t, long, "-n-code-holiday-")
+}
+
+func TestManifest(t *testing.T) {
+	t.Parallel()
+
+	var outputDir = t.TempDir()
+	var m, err = Open(outputDir)
+	assert.NoError(t, err)
+	assert.Empty(t, m.Entries)
+
+	var entry = m.Files("/photos/2019/misc")
+	assert.Equal(t, filepath.Join(outputDir, Slug("/photos/2019/misc")+".json"), entry.Cache)
+	assert.Equal(t, filepath.Join(outputDir, Slug("/photos/2019/misc")+"-delete.json"), entry.DeleteLog)
+	m.Set(entry)
+
+	var empty = m.Files("/photos/2020/misc")
+	empty.DeleteLog = ""
+	m.Set(empty)
+	assert.NoError(t, m.Write())
+
+	m, err = Open(outputDir)
+	assert.NoError(t, err)
+	assert.Len(t, m.Entries, 2)
+	assert.Equal(t, entry.Cache, m.Files("/photos/2019/misc").Cache, "names only depend on the dir")
+	assert.Equal(t, []string{entry.DeleteLog}, m.DeleteLogs())
+
+	_, err = Read(filepath.Join(outputDir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestDone(t *testing.T) {
+	t.Parallel()
+
+	var now = time.Now()
+	var files = []FileState{{Path: "/photos/a.jpg", Size: 10, ModTime: now}, {Path: "/photos/b.jpg", Size: 20, ModTime: now}}
+	var fingerprint = Fingerprint(10, files)
+	assert.Equal(t, fingerprint, Fingerprint(10, []FileState{files[1], files[0]}), "order does not matter")
+	assert.NotEqual(t, fingerprint, Fingerprint(5, files), "another distance is another result")
+	assert.NotEqual(t, fingerprint, Fingerprint(10, files[:1]))
+	assert.NotEqual(t, fingerprint, Fingerprint(10, []FileState{files[0], {Path: "/photos/b.jpg", Size: 21, ModTime: now}}))
+
+	var m, err = Open(t.TempDir())
+	assert.NoError(t, err)
+	assert.False(t, m.Done("/photos", fingerprint))
+
+	var entry = m.Files("/photos")
+	entry.Fingerprint = fingerprint
+	m.Set(entry)
+	assert.False(t, m.Done("/photos", fingerprint), "the cache and delete log are missing")
+
+	assert.NoError(t, os.WriteFile(entry.Cache, []byte("{}"), 0600))
+	assert.NoError(t, os.WriteFile(entry.DeleteLog, []byte("[]"), 0600))
+	assert.True(t, m.Done("/photos", fingerprint))
+	assert.False(t, m.Done("/photos", Fingerprint(10, files[:1])))
+
+	assert.True(t, m.Forget("/photos/"))
+	assert.False(t, m.Done("/photos", fingerprint))
+	assert.False(t, m.Forget("/photos"))
+}
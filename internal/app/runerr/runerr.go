@@ -0,0 +1,233 @@
+// Package runerr collects the errors a run can get past by leaving out the file or dir they happened
+// on, so one unreadable dir does not throw away hours of hashing, and writes them to a report.
+package runerr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReportFileName is the name of the error report uniqdirs writes to its output dir.
+const ReportFileName = "errors.json"
+
+// ErrUnknownPolicy is returned when parsing a policy we do not support.
+var ErrUnknownPolicy = errors.New("unknown error policy")
+
+// Stage is the part of a run an error happened in.
+type Stage string
+
+// the stages of a run.
+const (
+	StageList    Stage = "list"    // finding the images
+	StageCache   Stage = "cache"   // loading or saving a hash cache
+	StageHash    Stage = "hash"    // decoding and hashing an image
+	StageCompare Stage = "compare" // diffing two hashes
+	StageLog     Stage = "log"     // writing a delete log
+	StageDelete  Stage = "delete"  // deleting, trashing or quarantining a file
+)
+
+// Error is an error that only costs the path it happened on.
+type Error struct {
+	Stage Stage
+	Path  string
+	Err   error
+}
+
+// New returns an error of stage for path.
+func New(stage Stage, path string, err error) *Error {
+	return &Error{Stage: stage, Path: path, Err: err}
+}
+
+// Error fulfils the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s failed for: %s, err: %s", e.Stage, e.Path, e.Err)
+}
+
+// Unwrap returns the cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Policy is what a run does about an Error.
+type Policy int
+
+const (
+	// Continue records the error, leaves out its path and goes on.
+	Continue Policy = iota
+	// FailFast stops the run at the first error, after saving what it has done so far.
+	FailFast
+)
+
+// String fulfils the fmt.Stringer interface.
+func (p Policy) String() string {
+	if p == FailFast {
+		return "fail-fast"
+	}
+	return "continue"
+}
+
+// ParsePolicy parses the name of a policy.
+func ParsePolicy(name string) (Policy, error) {
+	switch strings.ToLower(name) {
+	case "", "continue":
+		return Continue, nil
+	case "fail-fast":
+		return FailFast, nil
+	default:
+		return Continue, fmt.Errorf("%w: %s", ErrUnknownPolicy, name)
+	}
+}
+
+// Entry is an error in the report. An image that can not be decoded fails every pair it is in, the
+// same error on the same path is one entry with a count.
+type Entry struct {
+	Stage Stage     `json:"stage,omitempty"`
+	Path  string    `json:"path,omitempty"`
+	Error string    `json:"error"`
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+}
+
+// Report is the errors of a run.
+type Report struct {
+	Created time.Time `json:"created"`
+	Policy  string    `json:"policy"`
+	Errors  []Entry   `json:"errors"`
+}
+
+// Collector records the errors of a run, it is safe to use from many goroutines.
+type Collector struct {
+	policy  Policy
+	lock    sync.Mutex
+	entries []Entry
+	index   map[Entry]int  // stage, path and error of an entry -> its position
+	carried map[Entry]bool // entries of an earlier run that did not happen in this one yet
+}
+
+// NewCollector returns a collector that applies policy.
+func NewCollector(policy Policy) *Collector {
+	return &Collector{policy: policy, index: make(map[Entry]int), carried: make(map[Entry]bool)}
+}
+
+// Carry adds the entries of report, the one of an earlier run, that keep returns true for. They are the errors
+// of the work this run does not do again, e.g. the pairs before the checkpoint of a resumed run, so the report
+// still lists them. A nil report carries nothing.
+func (c *Collector) Carry(report *Report, keep func(Entry) bool) {
+	if report == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, entry := range report.Errors {
+		var key = Entry{Stage: entry.Stage, Path: entry.Path, Error: entry.Error}
+		if _, found := c.index[key]; found || !keep(entry) {
+			continue
+		}
+		c.index[key] = len(c.entries)
+		c.carried[key] = true
+		c.entries = append(c.entries, entry)
+	}
+}
+
+// Record adds err to the report, logging it the first time, and returns it when the run has to stop, nil when it goes on.
+// Errors that are not an *Error are recorded without a stage and path.
+func (c *Collector) Record(err error) error {
+	if err == nil {
+		return nil
+	}
+	var key = Entry{Error: err.Error()}
+	var typed *Error
+	if errors.As(err, &typed) {
+		key = Entry{Stage: typed.Stage, Path: typed.Path, Error: typed.Err.Error()}
+	}
+
+	c.lock.Lock()
+	if i, found := c.index[key]; found {
+		c.entries[i].Count++
+		if c.carried[key] {
+			log.Error(err)
+			delete(c.carried, key)
+		}
+	} else {
+		log.Error(err)
+		c.index[key] = len(c.entries)
+		var entry = key
+		entry.Count, entry.First = 1, time.Now()
+		c.entries = append(c.entries, entry)
+	}
+	c.lock.Unlock()
+
+	if c.policy == FailFast {
+		return err
+	}
+	return nil
+}
+
+// Len returns how many distinct errors were recorded.
+func (c *Collector) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
+
+// Report returns the errors in the order they first happened.
+func (c *Collector) Report() *Report {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return &Report{Created: time.Now(), Policy: c.policy.String(), Errors: append([]Entry{}, c.entries...)}
+}
+
+// WriteJSON writes the report to fileName, replacing the report of an earlier run.
+func (r *Report) WriteJSON(fileName string) error {
+	var data, err = json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode error report: %s, err: %w", fileName, err)
+	}
+	if err := os.WriteFile(fileName, data, 0600); err != nil {
+		return fmt.Errorf("unable to write error report: %s, err: %w", fileName, err)
+	}
+	return nil
+}
+
+// ReadReport reads a report written by WriteJSON.
+func ReadReport(fileName string) (*Report, error) {
+	// #nosec G304: fileName is given to us by the user.
+	var data, err = os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read error report: %s, err: %w", fileName, err)
+	}
+	var report = new(Report)
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("unable to decode error report: %s, err: %w", fileName, err)
+	}
+	return report, nil
+}
+
+// Previous reads the report an earlier run wrote to fileName, it is nil when there is none.
+func Previous(fileName string) (*Report, error) {
+	var report, err = ReadReport(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return report, err
+}
+
+// Write writes the report of c to fileName, or removes the report of an earlier run when there were no errors,
+// see Carry to keep the errors of an earlier run.
+func (c *Collector) Write(fileName string) error {
+	if c.Len() == 0 {
+		if err := os.Remove(fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove old error report: %s, err: %w", fileName, err)
+		}
+		return nil
+	}
+	return c.Report().WriteJSON(fileName)
+}
@@ -0,0 +1,73 @@
+package runerr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	var errs = NewCollector(Continue)
+	var unreadable = New(StageList, "/photos/locked", os.ErrPermission)
+	assert.NoError(t, errs.Record(unreadable))
+	assert.NoError(t, errs.Record(New(StageHash, "/photos/broken.jpg", errors.New("unexpected EOF"))))
+	assert.NoError(t, errs.Record(New(StageHash, "/photos/broken.jpg", errors.New("unexpected EOF"))), "every pair with the image fails")
+	assert.NoError(t, errs.Record(errors.New("disk full")))
+	assert.NoError(t, errs.Record(nil))
+	assert.Equal(t, 3, errs.Len())
+	assert.ErrorIs(t, unreadable, os.ErrPermission)
+	assert.Equal(t, "list failed for: /photos/locked, err: permission denied", unreadable.Error())
+
+	var fileName = filepath.Join(t.TempDir(), "errors.json")
+	assert.NoError(t, errs.Write(fileName))
+	report, err := ReadReport(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "continue", report.Policy)
+	assert.Len(t, report.Errors, 3)
+	assert.Equal(t, Entry{Stage: StageHash, Path: "/photos/broken.jpg", Error: "unexpected EOF", Count: 2}, Entry{Stage: report.Errors[1].Stage, Path: report.Errors[1].Path, Error: report.Errors[1].Error, Count: report.Errors[1].Count})
+	assert.Equal(t, "disk full", report.Errors[2].Error)
+
+	// a resumed run keeps the errors of the work it does not do again
+	previous, err := Previous(fileName)
+	assert.NoError(t, err)
+	errs = NewCollector(Continue)
+	errs.Carry(previous, func(entry Entry) bool { return entry.Stage != StageList })
+	assert.NoError(t, errs.Record(New(StageHash, "/photos/broken.jpg", errors.New("unexpected EOF"))))
+	assert.NoError(t, errs.Write(fileName))
+	report, err = ReadReport(fileName)
+	assert.NoError(t, err)
+	assert.Len(t, report.Errors, 2)
+	assert.Equal(t, "/photos/broken.jpg", report.Errors[0].Path)
+	assert.Equal(t, 3, report.Errors[0].Count)
+
+	// a run without errors removes the report of the last one
+	assert.NoError(t, NewCollector(Continue).Write(fileName))
+	assert.NoFileExists(t, fileName)
+	assert.NoError(t, NewCollector(Continue).Write(fileName))
+	previous, err = Previous(fileName)
+	assert.NoError(t, err)
+	assert.Nil(t, previous)
+	NewCollector(Continue).Carry(previous, nil)
+
+	errs = NewCollector(FailFast)
+	assert.ErrorIs(t, errs.Record(unreadable), os.ErrPermission)
+	assert.Equal(t, 1, errs.Len())
+}
+
+func TestParsePolicy(t *testing.T) {
+	t.Parallel()
+
+	var policy, err = ParsePolicy("Fail-Fast")
+	assert.NoError(t, err)
+	assert.Equal(t, FailFast, policy)
+	policy, err = ParsePolicy("")
+	assert.NoError(t, err)
+	assert.Equal(t, Continue, policy)
+	_, err = ParsePolicy("retry")
+	assert.ErrorIs(t, err, ErrUnknownPolicy)
+}
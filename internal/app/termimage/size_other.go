@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package termimage
+
+import "os"
+
+// TerminalSize returns a common terminal size as we do not know how to ask on this platform.
+func TerminalSize(_ *os.File) Size {
+	return defaultSize
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd
+
+package termimage
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// TerminalSize asks the terminal attached to f for its size.
+func TerminalSize(f *os.File) Size {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+
+	//nolint:gosec // the pointer is only used for the duration of the ioctl
+	var _, _, errno = syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Col == 0 || ws.Row == 0 {
+		return defaultSize
+	}
+
+	return Size{Cols: int(ws.Col), Rows: int(ws.Row), Width: int(ws.Xpixel), Height: int(ws.Ypixel)}
+}
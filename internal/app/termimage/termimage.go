@@ -0,0 +1,288 @@
+// Package termimage draws images directly in a terminal using the kitty graphics protocol,
+// sixel or, when neither is available, 24-bit colour ANSI half blocks.
+package termimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrUnknownProtocol is returned when parsing a protocol name we do not support.
+var ErrUnknownProtocol = errors.New("unknown terminal graphics protocol")
+
+// Protocol is how images are drawn in the terminal.
+type Protocol int
+
+const (
+	// HalfBlock draws two pixels per cell with ▀ and 24-bit fg/bg colours, it works almost everywhere.
+	HalfBlock Protocol = iota
+	// Kitty is the kitty graphics protocol, also supported by WezTerm, Ghostty and Konsole.
+	Kitty
+	// Sixel is the DEC sixel format, supported by xterm -ti vt340, foot, mlterm, mintty and others.
+	Sixel
+)
+
+// String fulfils the fmt.Stringer interface.
+func (p Protocol) String() string {
+	switch p {
+	case Kitty:
+		return "kitty"
+	case Sixel:
+		return "sixel"
+	default:
+		return "ansi"
+	}
+}
+
+// ParseProtocol parses the name of a protocol, "auto" detects it from the environment.
+func ParseProtocol(name string) (Protocol, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return Detect(), nil
+	case "kitty":
+		return Kitty, nil
+	case "sixel":
+		return Sixel, nil
+	case "ansi", "halfblock":
+		return HalfBlock, nil
+	default:
+		return HalfBlock, fmt.Errorf("%w: %s", ErrUnknownProtocol, name)
+	}
+}
+
+// Detect guesses the best protocol from the environment. Querying the terminal would be more accurate
+// but requires putting it in raw mode, the environment is good enough for the terminals people use.
+func Detect() Protocol {
+	var term = os.Getenv("TERM")
+	var program = os.Getenv("TERM_PROGRAM")
+
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "", term == "xterm-kitty", term == "xterm-ghostty",
+		program == "WezTerm", program == "ghostty", os.Getenv("KONSOLE_VERSION") != "":
+		return Kitty
+	case strings.Contains(term, "sixel"), strings.HasPrefix(term, "foot"), term == "mlterm",
+		program == "mintty", program == "iTerm.app":
+		return Sixel
+	default:
+		return HalfBlock
+	}
+}
+
+// Size is the terminal size in cells and, when the terminal reports it, in pixels.
+type Size struct {
+	Cols, Rows    int
+	Width, Height int
+}
+
+// defaultSize is used when the terminal size can not be found.
+var defaultSize = Size{Cols: 80, Rows: 24}
+
+// cellSize returns the pixel size of a cell, guessing a common one if the terminal did not say.
+func (s Size) cellSize() (int, int) {
+	if s.Width > 0 && s.Height > 0 && s.Cols > 0 && s.Rows > 0 {
+		return s.Width / s.Cols, s.Height / s.Rows
+	}
+	return 10, 20
+}
+
+// SideBySide scales every image to fit in a box of boxW x boxH pixels and lays them out left to right with a gap between them.
+func SideBySide(images []image.Image, boxW, boxH, gap int) image.Image {
+	return Grid(images, len(images), boxW, boxH, gap)
+}
+
+// Grid scales every image to fit in a box of boxW x boxH pixels and lays them out left to right,
+// top to bottom, columns boxes per row with a gap between them.
+func Grid(images []image.Image, columns, boxW, boxH, gap int) image.Image {
+	columns = max(min(columns, len(images)), 1)
+	var rows = (len(images) + columns - 1) / columns
+	var canvas = image.NewRGBA(image.Rect(0, 0, columns*boxW+(columns-1)*gap, rows*boxH+(rows-1)*gap))
+
+	for i, img := range images {
+		var scaled = Fit(img, boxW, boxH)
+		var col, row = i % columns, i / columns
+		var offset = image.Pt(col*(boxW+gap)+(boxW-scaled.Bounds().Dx())/2, row*(boxH+gap)+(boxH-scaled.Bounds().Dy())/2)
+		draw.Draw(canvas, scaled.Bounds().Add(offset), scaled, scaled.Bounds().Min, draw.Src)
+	}
+
+	return canvas
+}
+
+// Fit scales the image down, keeping its aspect ratio, so it fits in maxW x maxH. Each destination
+// pixel is the average of the source pixels it covers which looks far better than nearest neighbour
+// when shrinking photos to terminal sizes.
+func Fit(img image.Image, maxW, maxH int) *image.RGBA {
+	var b = img.Bounds()
+	var w, h = b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	var scale = min(float64(maxW)/float64(w), float64(maxH)/float64(h), 1)
+	var dw, dh = max(int(float64(w)*scale), 1), max(int(float64(h)*scale), 1)
+	var dst = image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := range dh {
+		var sy0, sy1 = b.Min.Y + y*h/dh, b.Min.Y + max((y+1)*h/dh, y*h/dh+1)
+		for x := range dw {
+			var sx0, sx1 = b.Min.X + x*w/dw, b.Min.X + max((x+1)*w/dw, x*w/dw+1)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					var cr, cg, cb, ca = img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			//nolint:gosec // averages of 16 bit values shifted to 8 bits can not overflow
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+
+	return dst
+}
+
+// Render draws the image using at most cols x rows cells of the terminal.
+func Render(w io.Writer, img image.Image, p Protocol, size Size, cols, rows int) error {
+	var cellW, cellH = size.cellSize()
+
+	switch p {
+	case Kitty:
+		return renderKitty(w, Fit(img, cols*cellW, rows*cellH), cols, rows)
+	case Sixel:
+		return renderSixel(w, Fit(img, cols*cellW, rows*cellH))
+	default:
+		return renderHalfBlock(w, Fit(img, cols, rows*2))
+	}
+}
+
+// renderKitty sends the image as a png in 4096 byte chunks and lets the terminal scale it into the cells.
+func renderKitty(w io.Writer, img image.Image, cols, rows int) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("unable to encode png, err: %w", err)
+	}
+	var payload = base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	var out strings.Builder
+	for first := true; len(payload) > 0; first = false {
+		var chunk = payload[:min(4096, len(payload))]
+		payload = payload[len(chunk):]
+
+		var more = 0
+		if len(payload) > 0 {
+			more = 1
+		}
+		if first {
+			var b = img.Bounds()
+			// fit inside cols x rows keeping the aspect ratio, only one of c or r is given so the terminal keeps it
+			if b.Dx()*rows*2 >= b.Dy()*cols {
+				fmt.Fprintf(&out, "\x1b_Ga=T,f=100,q=2,c=%d,m=%d;%s\x1b\\", cols, more, chunk)
+			} else {
+				fmt.Fprintf(&out, "\x1b_Ga=T,f=100,q=2,r=%d,m=%d;%s\x1b\\", rows, more, chunk)
+			}
+		} else {
+			fmt.Fprintf(&out, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	out.WriteString("\n")
+
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return fmt.Errorf("unable to write image, err: %w", err)
+	}
+	return nil
+}
+
+// renderHalfBlock draws two vertical pixels per cell, the top one as the foreground of ▀ and the bottom one as the background.
+func renderHalfBlock(w io.Writer, img *image.RGBA) error {
+	var b = img.Bounds()
+	var out strings.Builder
+
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var top = img.RGBAAt(x, y)
+			var bottom = top
+			if y+1 < b.Max.Y {
+				bottom = img.RGBAAt(x, y+1)
+			}
+			fmt.Fprintf(&out, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		out.WriteString("\x1b[0m\n")
+	}
+
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return fmt.Errorf("unable to write image, err: %w", err)
+	}
+	return nil
+}
+
+// renderSixel quantizes the image to a 6x6x6 colour cube and writes it as run length encoded sixels.
+func renderSixel(w io.Writer, img *image.RGBA) error {
+	var b = img.Bounds()
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "\x1bPq\"1;1;%d;%d", b.Dx(), b.Dy())
+	for i := range 216 {
+		fmt.Fprintf(&out, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+	}
+
+	var indexes = make([]int, b.Dx())
+	for band := b.Min.Y; band < b.Max.Y; band += 6 {
+		// which colours are used in this band and which sixel bits each column has for them
+		var bits = make(map[int][]byte)
+		var order []int
+		for dy := 0; dy < 6 && band+dy < b.Max.Y; dy++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				var c = img.RGBAAt(x, band+dy)
+				indexes[x-b.Min.X] = int(c.R)*6/256*36 + int(c.G)*6/256*6 + int(c.B)*6/256
+			}
+			for x, idx := range indexes {
+				if bits[idx] == nil {
+					bits[idx] = make([]byte, b.Dx())
+					order = append(order, idx)
+				}
+				bits[idx][x] |= 1 << dy
+			}
+		}
+
+		for i, idx := range order {
+			if i > 0 {
+				out.WriteByte('$')
+			}
+			fmt.Fprintf(&out, "#%d", idx)
+			writeSixelRuns(&out, bits[idx])
+		}
+		out.WriteByte('-')
+	}
+	out.WriteString("\x1b\\\n")
+
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return fmt.Errorf("unable to write image, err: %w", err)
+	}
+	return nil
+}
+
+// writeSixelRuns writes a row of sixels, repeats of more than three are run length encoded.
+func writeSixelRuns(out *strings.Builder, row []byte) {
+	for x := 0; x < len(row); {
+		var run = 1
+		for x+run < len(row) && row[x+run] == row[x] {
+			run++
+		}
+		var char = rune(row[x] + '?')
+		if run > 3 {
+			fmt.Fprintf(out, "!%d%c", run, char)
+		} else {
+			out.WriteString(strings.Repeat(string(char), run))
+		}
+		x += run
+	}
+}
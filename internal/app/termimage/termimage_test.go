@@ -0,0 +1,76 @@
+package termimage
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(w, h int) image.Image {
+	var img = image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	return img
+}
+
+func TestFit(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, image.Rect(0, 0, 40, 20), Fit(testImage(400, 200), 40, 40).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 10, 20), Fit(testImage(100, 200), 40, 20).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 4, 2), Fit(testImage(4, 2), 40, 40).Bounds(), "never scale up")
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, Fit(testImage(400, 200), 40, 40).RGBAAt(3, 3))
+
+	var both = SideBySide([]image.Image{testImage(400, 200), testImage(100, 200)}, 40, 40, 2)
+	assert.Equal(t, image.Rect(0, 0, 82, 40), both.Bounds())
+
+	var grid = Grid([]image.Image{testImage(400, 200), testImage(100, 200), testImage(10, 10)}, 2, 40, 40, 2)
+	assert.Equal(t, image.Rect(0, 0, 82, 82), grid.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, grid.At(20, 60), "third image starts the second row")
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	var img = testImage(400, 200)
+	var size = Size{Cols: 80, Rows: 24}
+
+	var out strings.Builder
+	assert.NoError(t, Render(&out, img, HalfBlock, size, 20, 5))
+	var lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, 20, strings.Count(lines[0], "▀"))
+	assert.Contains(t, lines[0], "\x1b[38;2;255;0;0m")
+
+	out.Reset()
+	assert.NoError(t, Render(&out, img, Sixel, size, 20, 5))
+	assert.True(t, strings.HasPrefix(out.String(), "\x1bPq\"1;1;200;100"))
+	assert.True(t, strings.HasSuffix(out.String(), "\x1b\\\n"))
+	assert.Contains(t, out.String(), "#180!200~") // a full row of pure red
+
+	out.Reset()
+	assert.NoError(t, Render(&out, testImage(2000, 1000), Kitty, Size{Cols: 100, Rows: 50, Width: 1000, Height: 1000}, 100, 50))
+	assert.True(t, strings.HasPrefix(out.String(), "\x1b_Ga=T,f=100,q=2,c=100,m="))
+	assert.Equal(t, 1, strings.Count(out.String(), "m=0;"), "exactly one final chunk")
+	assert.True(t, strings.HasSuffix(out.String(), "\x1b\\\n"))
+}
+
+func TestParseProtocol(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]Protocol{"kitty": Kitty, "SIXEL": Sixel, "ansi": HalfBlock} {
+		var p, err = ParseProtocol(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, p)
+		assert.Equal(t, strings.ToLower(name), p.String())
+	}
+
+	var _, err = ParseProtocol("braille")
+	assert.ErrorIs(t, err, ErrUnknownProtocol)
+}
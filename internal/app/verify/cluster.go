@@ -0,0 +1,174 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagemeta"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// ErrBadKeepers is returned when the keepers picked for a cluster can not be parsed.
+var ErrBadKeepers = errors.New("invalid keepers")
+
+// Cluster is a set of images that are all duplicates of each other, directly or through another member.
+type Cluster struct {
+	// Members are in the order they first appear in the log.
+	Members []string
+	// Pairs are the pairs from the log that connect the members.
+	Pairs []logger.DeleteEntry
+}
+
+// Clusters groups the pairs into clusters of connected images, so an image with six near copies is
+// reviewed once instead of in six pairs that may each pick a different keeper.
+func Clusters(pairs []logger.DeleteEntry) []Cluster {
+	var parent = make(map[string]string)
+	var find func(string) string
+	find = func(name string) string {
+		if parent[name] != name {
+			parent[name] = find(parent[name])
+		}
+		return parent[name]
+	}
+
+	var order []string
+	for _, pair := range pairs {
+		for _, name := range []string{pair.Big, pair.Small} {
+			if _, found := parent[name]; !found {
+				parent[name] = name
+				order = append(order, name)
+			}
+		}
+		parent[find(pair.Small)] = find(pair.Big)
+	}
+
+	var index = make(map[string]int) // root -> index in clusters
+	var clusters []Cluster
+	for _, name := range order {
+		var root = find(name)
+		var i, found = index[root]
+		if !found {
+			i = len(clusters)
+			index[root] = i
+			clusters = append(clusters, Cluster{})
+		}
+		clusters[i].Members = append(clusters[i].Members, name)
+	}
+	for _, pair := range pairs {
+		var i = index[find(pair.Big)]
+		clusters[i].Pairs = append(clusters[i].Pairs, pair)
+	}
+
+	return clusters
+}
+
+// PairFor returns the pair that deletes member in favour of keeper, ok is false when the log has no pair of the
+// two. Members of a cluster can be linked through others only, e.g. a~b and b~c, so a and c were never
+// compared and c is not a duplicate of a. The distance is the one of the pair, the snapshots are taken from the log.
+func (c Cluster) PairFor(keeper, member string) (logger.DeleteEntry, bool) {
+	var entry = logger.DeleteEntry{Big: keeper, Small: member, KeepReason: "picked in group review"}
+	var compared bool
+
+	for _, pair := range c.Pairs {
+		if (pair.Big == keeper && pair.Small == member) || (pair.Big == member && pair.Small == keeper) {
+			entry.Distance, compared = pair.Distance, true
+		}
+		for _, side := range []struct {
+			name string
+			info *logger.FileSnapshot
+		}{{pair.Big, pair.BigInfo}, {pair.Small, pair.SmallInfo}} {
+			switch {
+			case side.info == nil:
+			case side.name == keeper:
+				entry.BigInfo = side.info
+			case side.name == member:
+				entry.SmallInfo = side.info
+			}
+		}
+	}
+
+	return entry, compared
+}
+
+// Closest returns the pair that deletes member in favour of the keeper it is closest to, ok is false when it
+// was not compared to any of them, see PairFor.
+func (c Cluster) Closest(keepers []string, member string) (logger.DeleteEntry, bool) {
+	var closest logger.DeleteEntry
+	var found bool
+	for _, keeper := range keepers {
+		if pair, ok := c.PairFor(keeper, member); ok && (!found || pair.Distance < closest.Distance) {
+			closest, found = pair, true
+		}
+	}
+	return closest, found
+}
+
+// Reference returns true when the member is in a reference library, nsquared -against never proposes those for deletion.
+func (c Cluster) Reference(member string) bool {
+	for _, pair := range c.Pairs {
+		if pair.Reference && pair.Big == member {
+			return true
+		}
+	}
+	return false
+}
+
+// SuggestKeeper returns the index of the member most worth keeping: the most pixels, then the largest file.
+func SuggestKeeper(members []imagemeta.Metadata) int {
+	var best int
+	for i, m := range members {
+		var area, bestArea = m.Width * m.Height, members[best].Width * members[best].Height
+		if area > bestArea || (area == bestArea && m.Size > members[best].Size) {
+			best = i
+		}
+	}
+	return best
+}
+
+// ParseKeepers parses the numbers the reviewer typed, e.g. "1" or "1, 3", and returns the 0 based indexes.
+func ParseKeepers(answer string, members int) ([]int, error) {
+	var keepers []int
+	var seen = make(map[int]bool)
+
+	for _, field := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' }) {
+		var n, err = strconv.Atoi(field)
+		if err != nil || n < 1 || n > members {
+			return nil, fmt.Errorf("%w: %q, pick numbers from 1 to %d", ErrBadKeepers, field, members)
+		}
+		if !seen[n-1] {
+			seen[n-1] = true
+			keepers = append(keepers, n-1)
+		}
+	}
+	if len(keepers) == 0 {
+		return nil, fmt.Errorf("%w: %q, pick at least one", ErrBadKeepers, answer)
+	}
+
+	return keepers, nil
+}
+
+// WriteGroup writes a numbered table of the members of a cluster, the suggested keeper is marked with *.
+func WriteGroup(w io.Writer, members []imagemeta.Metadata, suggested int) error {
+	var tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "#\tpath\tdimensions\tsize\tformat\tquality\tmodified\tcamera\n")
+	for i, m := range members {
+		var mark = " "
+		if i == suggested {
+			mark = "*"
+		}
+		fmt.Fprintf(tw, "%d%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, mark, m.Path, dimensions(m),
+			orUnknown(m.Size > 0, filelist.FormatBytes(m.Size)), orUnknown(m.Format != "", m.Format), quality(m),
+			timestamp(m.ModTime), orUnknown(m.Camera != "", m.Camera))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to write group table, err: %w", err)
+	}
+	return nil
+}
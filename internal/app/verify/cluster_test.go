@@ -0,0 +1,77 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/imagemeta"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusters(t *testing.T) {
+	t.Parallel()
+
+	var bInfo = &logger.FileSnapshot{Size: 2}
+	var pairs = []logger.DeleteEntry{
+		{Big: "a", Small: "b", Distance: 1, SmallInfo: bInfo},
+		{Big: "x", Small: "y"},
+		{Big: "c", Small: "b", Distance: 3},
+		{Big: "c", Small: "d"},
+	}
+
+	var clusters = Clusters(pairs)
+	assert.Len(t, clusters, 2)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, clusters[0].Members)
+	assert.Len(t, clusters[0].Pairs, 3)
+	assert.Equal(t, []string{"x", "y"}, clusters[1].Members)
+
+	// the keeper can be a different image than the log picked
+	var pair, ok = clusters[0].PairFor("c", "b")
+	assert.True(t, ok)
+	assert.Equal(t, "c", pair.Big)
+	assert.Equal(t, 3, pair.Distance)
+	assert.Equal(t, bInfo, pair.SmallInfo)
+	pair, ok = clusters[0].PairFor("b", "a")
+	assert.True(t, ok)
+	assert.Equal(t, bInfo, pair.BigInfo)
+
+	// a and d are only linked through b and c, they were never compared
+	_, ok = clusters[0].PairFor("a", "d")
+	assert.False(t, ok)
+	_, ok = clusters[0].Closest([]string{"a"}, "c")
+	assert.False(t, ok)
+	pair, ok = clusters[0].Closest([]string{"a", "c"}, "b")
+	assert.True(t, ok)
+	assert.Equal(t, "a", pair.Big)
+	assert.Equal(t, 1, pair.Distance)
+
+	clusters = Clusters([]logger.DeleteEntry{{Big: "archive", Small: "incoming", Reference: true}, {Big: "incoming", Small: "copy"}})
+	assert.True(t, clusters[0].Reference("archive"))
+	assert.False(t, clusters[0].Reference("incoming"))
+	assert.False(t, clusters[0].Reference("copy"))
+}
+
+func TestGroupReview(t *testing.T) {
+	t.Parallel()
+
+	var members = []imagemeta.Metadata{
+		{Path: "a", Width: 10, Height: 10, Size: 100},
+		{Path: "b", Width: 20, Height: 10, Size: 100},
+		{Path: "c", Width: 20, Height: 10, Size: 200},
+	}
+	assert.Equal(t, 2, SuggestKeeper(members))
+
+	var out strings.Builder
+	assert.NoError(t, WriteGroup(&out, members, 2))
+	assert.Contains(t, out.String(), "3*  c")
+
+	var keepers, err = ParseKeepers("3, 1 3", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 0}, keepers)
+
+	for _, bad := range []string{"", "0", "4", "a", ","} {
+		_, err = ParseKeepers(bad, 3)
+		assert.ErrorIs(t, err, ErrBadKeepers, bad)
+	}
+}
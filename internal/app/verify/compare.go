@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/internal/app/imagemeta"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// Escape codes used to highlight the fields that differ between the two images.
+const (
+	highlightOn  = "\x1b[1;33m"
+	highlightOff = "\x1b[0m"
+)
+
+// unknown is shown for anything that could not be read.
+const unknown = "?"
+
+// Comparison is the side by side facts about both images of a pair, shown to the reviewer with every prompt.
+type Comparison struct {
+	Pair       logger.DeleteEntry
+	Big, Small imagemeta.Metadata
+}
+
+// Compare reads the metadata of both images. Files that can not be read, e.g. ones deleted since the scan,
+// still get a comparison with whatever is known, falling back to the snapshot taken during the scan.
+func Compare(pair logger.DeleteEntry) Comparison {
+	var c = Comparison{Pair: pair}
+	c.Big, _ = imagemeta.Read(pair.Big)
+	c.Small, _ = imagemeta.Read(pair.Small)
+	fillFromSnapshot(&c.Big, pair.BigInfo)
+	fillFromSnapshot(&c.Small, pair.SmallInfo)
+	return c
+}
+
+// fillFromSnapshot fills in the size and mtime recorded in the log when the file itself could not be read.
+func fillFromSnapshot(m *imagemeta.Metadata, snapshot *logger.FileSnapshot) {
+	if snapshot == nil {
+		return
+	}
+	if m.Size == 0 {
+		m.Size = snapshot.Size
+	}
+	if m.ModTime.IsZero() {
+		m.ModTime = snapshot.ModTime
+	}
+}
+
+// Write writes the comparison as a table, rows where the images differ are highlighted if highlight is set.
+func (c Comparison) Write(w io.Writer, highlight bool) error {
+	var rows = [][3]string{
+		{"", "keep", "delete"},
+		{"path", c.Big.Path, c.Small.Path},
+		{"dimensions", dimensions(c.Big), dimensions(c.Small)},
+		{"size", orUnknown(c.Big.Size > 0, filelist.FormatBytes(c.Big.Size)), orUnknown(c.Small.Size > 0, filelist.FormatBytes(c.Small.Size))},
+		{"format", orUnknown(c.Big.Format != "", c.Big.Format), orUnknown(c.Small.Format != "", c.Small.Format)},
+		{"quality", quality(c.Big), quality(c.Small)},
+		{"modified", timestamp(c.Big.ModTime), timestamp(c.Small.ModTime)},
+		{"camera", orUnknown(c.Big.Camera != "", c.Big.Camera), orUnknown(c.Small.Camera != "", c.Small.Camera)},
+		{"captured", timestamp(c.Big.Captured), timestamp(c.Small.Captured)},
+	}
+
+	// tabwriter counts escape codes as text so the columns are padded by hand
+	var labelWidth, bigWidth int
+	for _, row := range rows {
+		labelWidth = max(labelWidth, len(row[0]))
+		bigWidth = max(bigWidth, len([]rune(row[1])))
+	}
+
+	var out strings.Builder
+	for i, row := range rows {
+		var big, small = pad(row[1], bigWidth), row[2]
+		if highlight && i > 1 && row[1] != row[2] {
+			big, small = highlightOn+big+highlightOff, highlightOn+small+highlightOff
+		}
+		fmt.Fprintf(&out, "%-*s  %s  %s\n", labelWidth, row[0], big, small)
+	}
+	fmt.Fprintf(&out, "%-*s  %s\n", labelWidth, "distance", distance(c.Pair))
+	fmt.Fprintf(&out, "%-*s  %s\n", labelWidth, "kept by", orUnknown(c.Pair.KeepReason != "", c.Pair.KeepReason))
+
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return fmt.Errorf("unable to write comparison table, err: %w", err)
+	}
+	return nil
+}
+
+// pad right pads s with spaces to width runes.
+func pad(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-len([]rune(s)), 0))
+}
+
+// orUnknown returns value if known is true.
+func orUnknown(known bool, value string) string {
+	if known {
+		return value
+	}
+	return unknown
+}
+
+// dimensions is WIDTHxHEIGHT, unknown when the image could not be decoded.
+func dimensions(m imagemeta.Metadata) string {
+	return orUnknown(m.Width > 0, fmt.Sprintf("%dx%d", m.Width, m.Height))
+}
+
+// quality is the estimated jpeg quality, unknown for other formats.
+func quality(m imagemeta.Metadata) string {
+	return orUnknown(m.Quality > 0, strconv.Itoa(m.Quality))
+}
+
+// timestamp formats t as a date and time, unknown when it is zero.
+func timestamp(t time.Time) string {
+	return orUnknown(!t.IsZero(), t.Format(time.DateTime))
+}
+
+// distance is only known for logs that have snapshots, older ones always wrote 0.
+func distance(pair logger.DeleteEntry) string {
+	return orUnknown(pair.BigInfo != nil || pair.SmallInfo != nil, strconv.Itoa(pair.Distance))
+}
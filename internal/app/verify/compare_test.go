@@ -0,0 +1,42 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparison(t *testing.T) {
+	t.Parallel()
+
+	var pair = logger.DeleteEntry{
+		Big:        "../imagedup/testimages/iceland.jpg",
+		Small:      "../imagedup/testimages/iceland-small.jpg",
+		Distance:   2,
+		KeepReason: "larger area: 272640 > 68160 pixels",
+		BigInfo:    &logger.FileSnapshot{},
+	}
+
+	var out strings.Builder
+	assert.NoError(t, Compare(pair).Write(&out, false))
+	var table = out.String()
+	assert.Contains(t, table, "dimensions  640x426")
+	assert.Contains(t, table, "Canon EOS 5D Mark II")
+	assert.Contains(t, table, "distance    2\n")
+	assert.Contains(t, table, "kept by     larger area: 272640 > 68160 pixels\n")
+	assert.NotContains(t, table, highlightOn)
+
+	out.Reset()
+	assert.NoError(t, Compare(pair).Write(&out, true))
+	assert.Contains(t, out.String(), highlightOn+"640x426")
+	assert.NotContains(t, out.String(), highlightOn+"jpeg", "same format is not highlighted")
+
+	// legacy logs have no distance or keep reason and missing files are unknown
+	out.Reset()
+	assert.NoError(t, Compare(logger.DeleteEntry{Big: "gone.jpg", Small: "../imagedup/testimages/trees.jpg"}).Write(&out, false))
+	assert.Contains(t, out.String(), "distance    ?\n")
+	assert.Contains(t, out.String(), "kept by     ?\n")
+	assert.Contains(t, out.String(), "dimensions  ?")
+}
@@ -0,0 +1,165 @@
+package verify
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// ErrNothingToUndo is returned when undo is asked to reverse more actions than the journal holds.
+var ErrNothingToUndo = errors.New("nothing left to undo")
+
+// Decision is what was decided about a pair.
+type Decision string
+
+const (
+	// DecisionApplied means the small image was deleted, quarantined or trashed.
+	DecisionApplied Decision = "applied"
+	// DecisionKept means the reviewer chose to keep both images.
+	DecisionKept Decision = "kept"
+	// DecisionGrouped means the pair was settled as part of reviewing its whole cluster.
+	DecisionGrouped Decision = "grouped"
+	// DecisionUndone means an earlier applied action was reversed, the pair is undecided again.
+	DecisionUndone Decision = "undone"
+)
+
+// JournalEntry is a single line in the journal.
+type JournalEntry struct {
+	Time     time.Time `json:"time"`
+	Big      string    `json:"big"`
+	Small    string    `json:"small"`
+	Decision Decision  `json:"decision"`
+	Action   *Action   `json:"action,omitempty"`
+}
+
+// Journal records every decision made about the pairs in a delete log, one json object per line,
+// so a run can be resumed and reversible actions can be undone.
+type Journal struct {
+	FileName   string
+	file       *os.File
+	decided    map[string]Decision
+	reversible []JournalEntry
+}
+
+// JournalFileName returns the journal that goes with a delete log.
+func JournalFileName(deleteLog string) string {
+	return strings.TrimSuffix(deleteLog, ".json") + "-journal.jsonl"
+}
+
+// OpenJournal replays an existing journal, or creates a new one, and opens it for appending.
+func OpenJournal(fileName string) (*Journal, error) {
+	var j = &Journal{FileName: fileName, decided: make(map[string]Decision)}
+
+	// #nosec G304: fileName is derived from the delete log passed on the command line.
+	var file, err = os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open journal: %s, err: %w", fileName, err)
+	}
+
+	var scanner = bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			_ = file.Close() // already returning the more useful error
+			return nil, fmt.Errorf("unable to unmarshal journal: %s, line: %d, err: %w", fileName, line, err)
+		}
+		j.replay(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		_ = file.Close() // already returning the more useful error
+		return nil, fmt.Errorf("unable to read journal: %s, err: %w", fileName, err)
+	}
+
+	j.file = file
+	return j, nil
+}
+
+// replay updates the in memory state with an entry.
+func (j *Journal) replay(entry JournalEntry) {
+	var key = pairKey(entry.Big, entry.Small)
+
+	switch entry.Decision {
+	case DecisionUndone:
+		delete(j.decided, key)
+		for i := len(j.reversible) - 1; i >= 0; i-- {
+			if pairKey(j.reversible[i].Big, j.reversible[i].Small) == key {
+				j.reversible = append(j.reversible[:i], j.reversible[i+1:]...)
+				break
+			}
+		}
+	default:
+		j.decided[key] = entry.Decision
+		if entry.Action != nil && (entry.Action.Op == OpMove || entry.Action.Op == OpTrash) {
+			j.reversible = append(j.reversible, entry)
+		}
+	}
+}
+
+// Decided returns true if a decision has already been made about the pair.
+func (j *Journal) Decided(pair logger.DeleteEntry) bool {
+	var _, found = j.decided[pairKey(pair.Big, pair.Small)]
+	return found
+}
+
+// Record appends a decision to the journal.
+func (j *Journal) Record(pair logger.DeleteEntry, decision Decision, action *Action) error {
+	return j.write(JournalEntry{Time: time.Now(), Big: pair.Big, Small: pair.Small, Decision: decision, Action: action})
+}
+
+// write appends the entry to the file and replays it.
+func (j *Journal) write(entry JournalEntry) error {
+	var js, err = json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal journal entry, err: %w", err)
+	}
+	if _, err := j.file.Write(append(js, '\n')); err != nil {
+		return fmt.Errorf("unable to write journal: %s, err: %w", j.FileName, err)
+	}
+
+	j.replay(entry)
+	return nil
+}
+
+// Undo reverses the last n quarantine or trash actions, newest first, and returns them.
+func (j *Journal) Undo(n int) ([]Action, error) {
+	var undone []Action
+
+	for range n {
+		if len(j.reversible) == 0 {
+			return undone, fmt.Errorf("%w, %d actions undone", ErrNothingToUndo, len(undone))
+		}
+
+		var last = j.reversible[len(j.reversible)-1]
+		if err := last.Action.Undo(); err != nil {
+			return undone, err
+		}
+		if err := j.write(JournalEntry{Time: time.Now(), Big: last.Big, Small: last.Small, Decision: DecisionUndone, Action: last.Action}); err != nil {
+			return undone, err
+		}
+		undone = append(undone, *last.Action)
+	}
+
+	return undone, nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("unable to close journal: %s, err: %w", j.FileName, err)
+	}
+	return nil
+}
+
+// pairKey identifies a pair in the journal.
+func pairKey(big, small string) string {
+	return big + "\x00" + small
+}
@@ -0,0 +1,144 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	var dir = t.TempDir()
+	var journalFile = JournalFileName(filepath.Join(dir, "delete.json"))
+	assert.Equal(t, filepath.Join(dir, "delete-journal.jsonl"), journalFile)
+
+	var big = filepath.Join(dir, "big.jpg")
+	var one = filepath.Join(dir, "one.jpg")
+	var two = filepath.Join(dir, "two.jpg")
+	for _, file := range []string{big, one, two} {
+		assert.NoError(t, os.WriteFile(file, []byte(file), 0600))
+	}
+	var pairOne = logger.DeleteEntry{Big: big, Small: one}
+	var pairTwo = logger.DeleteEntry{Big: big, Small: two}
+	var pairThree = logger.DeleteEntry{Big: one, Small: two}
+
+	journal, err := OpenJournal(journalFile)
+	assert.NoError(t, err)
+
+	var applier = Applier{QuarantineDir: filepath.Join(dir, "quarantine")}
+	action, err := applier.Act(pairOne, "")
+	assert.NoError(t, err)
+	assert.NoError(t, journal.Record(pairOne, DecisionApplied, &action))
+	action, err = applier.Act(pairTwo, "")
+	assert.NoError(t, err)
+	assert.NoError(t, journal.Record(pairTwo, DecisionApplied, &action))
+	assert.NoError(t, journal.Record(pairThree, DecisionKept, nil))
+	assert.NoError(t, journal.Close())
+
+	// resume
+	journal, err = OpenJournal(journalFile)
+	assert.NoError(t, err)
+	assert.True(t, journal.Decided(pairOne))
+	assert.True(t, journal.Decided(pairTwo))
+	assert.True(t, journal.Decided(pairThree))
+
+	undone, err := journal.Undo(1)
+	assert.NoError(t, err)
+	assert.Len(t, undone, 1)
+	assert.Equal(t, two, undone[0].Path)
+	assert.FileExists(t, two)
+	assert.NoFileExists(t, one)
+	assert.False(t, journal.Decided(pairTwo))
+	assert.NoError(t, journal.Close())
+
+	// the undo survives a restart too
+	journal, err = OpenJournal(journalFile)
+	assert.NoError(t, err)
+	assert.False(t, journal.Decided(pairTwo))
+
+	undone, err = journal.Undo(5)
+	assert.ErrorIs(t, err, ErrNothingToUndo)
+	assert.Len(t, undone, 1)
+	assert.FileExists(t, one)
+	assert.NoError(t, journal.Close())
+}
+
+//nolint:paralleltest // t.Setenv
+func TestTrash(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("freedesktop.org trash only")
+	}
+
+	var dir = t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+
+	var big = filepath.Join(dir, "big.jpg")
+	var small = filepath.Join(dir, "small.jpg")
+	assert.NoError(t, os.WriteFile(big, []byte("big"), 0600))
+	assert.NoError(t, os.WriteFile(small, []byte("small"), 0600))
+
+	var applier = Applier{Trash: true}
+	var action, err = applier.Act(logger.DeleteEntry{Big: big, Small: small}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Trash", "files", "small.jpg"), action.Dest)
+	assert.FileExists(t, action.Dest)
+	assert.FileExists(t, filepath.Join(dir, "Trash", "info", "small.jpg.trashinfo"))
+
+	// name is taken now
+	dest, err := trashDest(small, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Trash", "files", "small.1.jpg"), dest)
+
+	// and so is the one a plan moves a file of the same name to
+	dest, err = trashDest(small, map[string]struct{}{dest: {}})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Trash", "files", "small.2.jpg"), dest)
+
+	assert.NoError(t, action.Undo())
+	assert.FileExists(t, small)
+	assert.NoFileExists(t, filepath.Join(dir, "Trash", "info", "small.jpg.trashinfo"))
+}
+
+//nolint:paralleltest // t.Setenv
+func TestPlanTrashSameName(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("freedesktop.org trash only")
+	}
+
+	var dir = t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "a"), 0700))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "b"), 0700))
+	var big = filepath.Join(dir, "big.jpg")
+	var smallA, smallB = filepath.Join(dir, "a", "small.jpg"), filepath.Join(dir, "b", "small.jpg")
+	for _, fileName := range []string{big, smallA, smallB} {
+		assert.NoError(t, os.WriteFile(fileName, []byte(fileName), 0600))
+	}
+
+	var applier = Applier{Trash: true, Plan: &Plan{Created: time.Now()}}
+	var first, err = applier.Act(logger.DeleteEntry{Big: big, Small: smallA}, "")
+	assert.NoError(t, err)
+	second, err := applier.Act(logger.DeleteEntry{Big: big, Small: smallB}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Trash", "files", "small.jpg"), first.Dest)
+	assert.Equal(t, filepath.Join(dir, "Trash", "files", "small.1.jpg"), second.Dest)
+
+	// a file that shows up at the dest before the plan is run is not replaced
+	assert.NoError(t, os.MkdirAll(filepath.Dir(first.Dest), 0700))
+	assert.NoError(t, os.WriteFile(first.Dest, []byte("other"), 0600))
+	assert.ErrorIs(t, first.Execute(), ErrDestExists)
+	assert.FileExists(t, smallA)
+	assert.NoError(t, second.Execute())
+	assert.NoFileExists(t, smallB)
+
+	// nor is one that shows up where the file is restored to
+	assert.NoError(t, os.WriteFile(smallB, []byte("recreated"), 0600))
+	assert.Error(t, second.Undo())
+	assert.FileExists(t, second.Dest)
+}
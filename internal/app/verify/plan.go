@@ -0,0 +1,356 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// ErrKeeperMissing is returned when the image we are keeping is gone, acting on its duplicate would lose the image entirely.
+var ErrKeeperMissing = errors.New("keeper is missing")
+
+// ErrDestExists is returned when a file would be moved over another one, e.g. a trashed file of the same name.
+var ErrDestExists = errors.New("destination already exists")
+
+// ErrIrreversible is returned when undoing an action that can not be undone, i.e. a delete.
+var ErrIrreversible = errors.New("action can not be undone")
+
+// Op is the kind of filesystem change an Action makes.
+type Op string
+
+const (
+	// OpDelete removes the file.
+	OpDelete Op = "delete"
+	// OpMove moves the file to Dest, e.g. into a quarantine dir.
+	OpMove Op = "move"
+	// OpTrash moves the file to Dest in the OS trash.
+	OpTrash Op = "trash"
+)
+
+// Action is a single filesystem change planned for the small image of a pair.
+type Action struct {
+	Op       Op                   `json:"op"`
+	Path     string               `json:"path"`
+	Dest     string               `json:"dest,omitempty"`
+	Keep     string               `json:"keep"`
+	Size     int64                `json:"size"`
+	Distance int                  `json:"distance"`
+	Reason   string               `json:"reason,omitempty"`
+	Snapshot *logger.FileSnapshot `json:"snapshot,omitempty"`
+}
+
+// Check makes sure the action is still safe to run: the keeper exists and the file has not changed since it was planned.
+func (a Action) Check() error {
+	if _, err := os.Stat(a.Keep); err != nil {
+		return fmt.Errorf("%w: %s, err: %w", ErrKeeperMissing, a.Keep, err)
+	}
+	if a.Snapshot != nil {
+		return a.Snapshot.Check(a.Path)
+	}
+	if _, err := os.Stat(a.Path); err != nil {
+		return fmt.Errorf("unable to stat file: %s, err: %w", a.Path, err)
+	}
+	return nil
+}
+
+// Execute makes the change on disk.
+func (a Action) Execute() error {
+	switch a.Op {
+	case OpDelete:
+		if err := os.Remove(a.Path); err != nil {
+			return fmt.Errorf("unable to remove file: %s, err: %w", a.Path, err)
+		}
+	case OpMove, OpTrash:
+		if err := os.MkdirAll(filepath.Dir(a.Dest), 0750); err != nil {
+			return fmt.Errorf("unable to create dir: %s, err: %w", filepath.Dir(a.Dest), err)
+		}
+		if a.Op == OpTrash {
+			if err := writeTrashInfo(a.Path, a.Dest); err != nil {
+				return err
+			}
+		}
+		if err := moveFile(a.Path, a.Dest); err != nil {
+			return fmt.Errorf("unable to move file: %s to: %s, err: %w", a.Path, a.Dest, err)
+		}
+	default:
+		return fmt.Errorf("unknown op: %q", a.Op)
+	}
+	return nil
+}
+
+// Undo moves a quarantined or trashed file back to where it came from.
+func (a Action) Undo() error {
+	if a.Op != OpMove && a.Op != OpTrash {
+		return fmt.Errorf("%w: %s %s", ErrIrreversible, a.Op, a.Path)
+	}
+	if _, err := os.Lstat(a.Path); err == nil {
+		return fmt.Errorf("unable to restore file: %s, a file with the same name already exists", a.Path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.Path), 0750); err != nil {
+		return fmt.Errorf("unable to create dir: %s, err: %w", filepath.Dir(a.Path), err)
+	}
+	if err := moveFile(a.Dest, a.Path); err != nil {
+		return fmt.Errorf("unable to move file: %s back to: %s, err: %w", a.Dest, a.Path, err)
+	}
+
+	if infoFile := trashInfoFile(a.Dest); a.Op == OpTrash && infoFile != "" {
+		if err := os.Remove(infoFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove trash info file: %s, err: %w", infoFile, err)
+		}
+	}
+	return nil
+}
+
+// moveFile renames src to dst, a quarantine dir or trash on another filesystem can not be renamed to
+// so the file is copied there instead. It never replaces a file that is already at dst.
+func moveFile(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%w: %s", ErrDestExists, dst)
+	}
+	var err = os.Rename(src, dst)
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) && errors.Is(linkErr.Err, syscall.EXDEV) {
+		return copyMove(src, dst)
+	}
+	return err
+}
+
+// copyMove moves src to dst by copying it, the copy is synced to disk before src is removed and keeps its mode
+// and mtime so a snapshot of src still matches it.
+func copyMove(src, dst string) error {
+	var info, err = os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("unable to stat file: %s, err: %w", src, err)
+	}
+	// #nosec G304: src is a file from the delete log or plan.
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("unable to open file: %s, err: %w", src, err)
+	}
+	defer func() {
+		_ = in.Close() // read only
+	}()
+
+	// #nosec G304: dst is in the quarantine dir or trash.
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrDestExists, dst)
+	} else if err != nil {
+		return fmt.Errorf("unable to create file: %s, err: %w", dst, err)
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst) // half a copy, src is still there
+		return fmt.Errorf("unable to copy file: %s to: %s, err: %w", src, dst, err)
+	}
+
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("unable to set mtime of file: %s, err: %w", dst, err)
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("unable to remove file: %s, err: %w", src, err)
+	}
+	return nil
+}
+
+// Plan is a reviewable list of actions, it can be saved, approved and run later.
+type Plan struct {
+	Created time.Time `json:"created"`
+	Actions []Action  `json:"actions"`
+}
+
+// ReadPlan reads a plan written by Plan.WriteJSON.
+func ReadPlan(fileName string) (*Plan, error) {
+	// #nosec G304: fileName is a plan file passed on the command line.
+	var content, err = os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan file: %s, err: %w", fileName, err)
+	}
+
+	var plan = new(Plan)
+	if err := json.Unmarshal(content, plan); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal plan file: %s, err: %w", fileName, err)
+	}
+
+	return plan, nil
+}
+
+// WriteJSON writes the plan as indented json.
+func (p *Plan) WriteJSON(fileName string) error {
+	var js, err = json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal plan, err: %w", err)
+	}
+	if err := os.WriteFile(fileName, js, 0600); err != nil {
+		return fmt.Errorf("unable to write plan file: %s, err: %w", fileName, err)
+	}
+	return nil
+}
+
+// WriteScript writes the plan as a POSIX shell script with a comment above each command.
+func (p *Plan) WriteScript(w io.Writer) error {
+	var total int64
+	for _, action := range p.Actions {
+		total += action.Size
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# generated by verify at %s\n", p.Created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "# %d actions, %s reclaimed\n", len(p.Actions), filelist.FormatBytes(total))
+	b.WriteString("set -eu\n")
+
+	for _, action := range p.Actions {
+		fmt.Fprintf(&b, "\n# keep %s\n", commentQuote(action.Keep))
+		fmt.Fprintf(&b, "# distance %d, %s", action.Distance, filelist.FormatBytes(action.Size))
+		if action.Reason != "" {
+			fmt.Fprintf(&b, ", %s", commentQuote(action.Reason))
+		}
+		b.WriteString("\n")
+
+		switch action.Op {
+		case OpDelete:
+			fmt.Fprintf(&b, "rm -- %s\n", shellQuote(action.Path))
+		case OpMove, OpTrash:
+			fmt.Fprintf(&b, "mkdir -p -- %s && mv -- %s %s\n", shellQuote(filepath.Dir(action.Dest)), shellQuote(action.Path), shellQuote(action.Dest))
+		default:
+			return fmt.Errorf("unknown op: %q", action.Op)
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("unable to write script, err: %w", err)
+	}
+	return nil
+}
+
+// shellQuote single quotes s so the shell does not interpret anything in it.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commentQuote makes s safe to put in a # comment, a newline in a file name would end the comment and run
+// the rest of the name. Names with control characters are written as a go quoted string.
+func commentQuote(s string) string {
+	if strings.ContainsFunc(s, unicode.IsControl) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Applier carries out actions for pairs, or only records them in Plan when dry running.
+type Applier struct {
+	// QuarantineDir, when set, moves files under it instead of deleting them.
+	QuarantineDir string
+	// Trash moves files to the OS trash instead of deleting them.
+	Trash bool
+	// Plan, when set, collects the actions instead of running them.
+	Plan *Plan
+
+	planned map[string]struct{} // files the plan removes
+	dests   map[string]struct{} // files the plan moves other files to
+}
+
+// Gone returns true if the file no longer exists, or will not exist once the plan is run.
+func (a *Applier) Gone(fileName string) bool {
+	if _, found := a.planned[fileName]; found {
+		return true
+	}
+	_, err := os.Stat(fileName)
+	return err != nil
+}
+
+// Act removes, quarantines or trashes the small image of the pair and returns what was done.
+func (a *Applier) Act(pair logger.DeleteEntry, reason string) (Action, error) {
+	var action, err = a.NewAction(pair, reason)
+	if err != nil {
+		return Action{}, err
+	}
+
+	if a.Plan != nil {
+		if a.planned == nil {
+			a.planned, a.dests = make(map[string]struct{}), make(map[string]struct{})
+		}
+		a.planned[action.Path] = struct{}{}
+		if action.Dest != "" {
+			a.dests[action.Dest] = struct{}{}
+		}
+		a.Plan.Actions = append(a.Plan.Actions, action)
+		return action, nil
+	}
+
+	if err := action.Execute(); err != nil {
+		return Action{}, err
+	}
+	return action, nil
+}
+
+// Verb describes what Act does, for log messages.
+func (a *Applier) Verb() string {
+	var verb = "deleted"
+	if a.QuarantineDir != "" {
+		verb = "quarantined"
+	} else if a.Trash {
+		verb = "trashed"
+	}
+	if a.Plan != nil {
+		return "planned to be " + verb
+	}
+	return verb
+}
+
+// NewAction builds the action for the small image of the pair.
+func (a *Applier) NewAction(pair logger.DeleteEntry, reason string) (Action, error) {
+	var info, err = os.Stat(pair.Small)
+	if err != nil {
+		return Action{}, fmt.Errorf("unable to stat file: %s, err: %w", pair.Small, err)
+	}
+
+	var action = Action{
+		Op:       OpDelete,
+		Path:     pair.Small,
+		Keep:     pair.Big,
+		Size:     info.Size(),
+		Distance: pair.Distance,
+		Reason:   reason,
+		Snapshot: pair.SmallInfo,
+	}
+
+	if a.QuarantineDir != "" {
+		abs, err := filepath.Abs(pair.Small)
+		if err != nil {
+			return Action{}, fmt.Errorf("unable to get absolute path: %s, err: %w", pair.Small, err)
+		}
+		quarantineDir, err := filepath.Abs(a.QuarantineDir)
+		if err != nil {
+			return Action{}, fmt.Errorf("unable to get absolute path: %s, err: %w", a.QuarantineDir, err)
+		}
+		action.Op = OpMove
+		action.Dest = filepath.Join(quarantineDir, strings.TrimPrefix(abs, filepath.VolumeName(abs)))
+	} else if a.Trash {
+		action.Op = OpTrash
+		action.Dest, err = trashDest(pair.Small, a.dests)
+		if err != nil {
+			return Action{}, err
+		}
+	}
+
+	return action, nil
+}
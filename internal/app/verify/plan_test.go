@@ -0,0 +1,118 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	var dir = t.TempDir()
+	var big = filepath.Join(dir, "big.jpg")
+	var small = filepath.Join(dir, "it's small.jpg")
+	assert.NoError(t, os.WriteFile(big, []byte("big"), 0600))
+	assert.NoError(t, os.WriteFile(small, []byte("small"), 0600))
+
+	var pair = logger.DeleteEntry{Big: big, Small: small, Distance: 1}
+	var applier = Applier{Plan: &Plan{Created: time.Now()}}
+
+	var action, err = applier.Act(pair, "testing")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), action.Size)
+	assert.FileExists(t, small) // dry run
+	assert.True(t, applier.Gone(small))
+	assert.False(t, applier.Gone(big))
+
+	var script strings.Builder
+	assert.NoError(t, applier.Plan.WriteScript(&script))
+	assert.Contains(t, script.String(), "# keep "+big)
+	assert.Contains(t, script.String(), "# distance 1, 5 B, testing")
+	assert.Contains(t, script.String(), `rm -- '`+dir+`/it'\''s small.jpg'`)
+
+	var planFile = filepath.Join(dir, "plan.json")
+	assert.NoError(t, applier.Plan.WriteJSON(planFile))
+	plan, err := ReadPlan(planFile)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Actions, 1)
+	assert.Equal(t, OpDelete, plan.Actions[0].Op)
+
+	// quarantine for real
+	var quarantine = filepath.Join(dir, "quarantine")
+	applier = Applier{QuarantineDir: quarantine}
+	action, err = applier.Act(pair, "")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, small)
+	assert.FileExists(t, filepath.Join(quarantine, small))
+
+	assert.NoError(t, action.Undo())
+	assert.FileExists(t, small)
+	assert.ErrorIs(t, plan.Actions[0].Undo(), ErrIrreversible)
+
+	// the keeper is gone so nothing should happen
+	assert.NoError(t, os.Remove(big))
+	assert.ErrorIs(t, plan.Actions[0].Check(), ErrKeeperMissing)
+}
+
+func TestPlanScriptNewline(t *testing.T) {
+	t.Parallel()
+
+	// a newline in a name must not end the comment, the rest of the name would run
+	var plan = Plan{Created: time.Now(), Actions: []Action{{
+		Op:     OpDelete,
+		Path:   "/photos/small\ntouch /tmp/owned.jpg",
+		Keep:   "/photos/big\ntouch /tmp/owned\n.jpg",
+		Reason: "rule\rtouch /tmp/owned",
+	}}}
+	var script strings.Builder
+	assert.NoError(t, plan.WriteScript(&script))
+	assert.Contains(t, script.String(), `# keep "/photos/big\ntouch /tmp/owned\n.jpg"`)
+	assert.Contains(t, script.String(), `, "rule\rtouch /tmp/owned"`)
+
+	var lines = strings.Split(strings.TrimSpace(script.String()), "\n")
+	assert.Equal(t, "rm -- '/photos/small", lines[len(lines)-2], "quoted over two lines")
+	for _, line := range lines[:len(lines)-2] {
+		if line != "" && line != "set -eu" {
+			assert.True(t, strings.HasPrefix(line, "#"), line)
+		}
+	}
+}
+
+func TestCopyMove(t *testing.T) {
+	t.Parallel()
+
+	// what a move to a quarantine dir on another filesystem falls back to
+	var dir = t.TempDir()
+	var src, dst = filepath.Join(dir, "small.jpg"), filepath.Join(dir, "quarantine.jpg")
+	var modTime = time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NoError(t, os.WriteFile(src, []byte("small"), 0640))
+	assert.NoError(t, os.Chtimes(src, modTime, modTime))
+
+	assert.NoError(t, copyMove(src, dst))
+	assert.NoFileExists(t, src)
+	var content, err = os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "small", string(content))
+	info, err := os.Stat(dst)
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(modTime))
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	assert.Error(t, copyMove(src, dst), "src is gone")
+	assert.FileExists(t, dst)
+
+	// never over another file
+	assert.NoError(t, os.WriteFile(src, []byte("other"), 0640))
+	assert.ErrorIs(t, copyMove(src, dst), ErrDestExists)
+	assert.ErrorIs(t, moveFile(src, dst), ErrDestExists)
+	content, err = os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "small", string(content))
+	assert.FileExists(t, src)
+}
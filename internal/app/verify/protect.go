@@ -0,0 +1,149 @@
+package verify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrBadProtectRule is returned when a protect rule can not be parsed.
+var ErrBadProtectRule = errors.New("invalid protect rule")
+
+// Kinds of protect rules, a rule without a kind is a glob.
+const (
+	protectGlob   = "glob"
+	protectRegex  = "regex"
+	protectPrefix = "prefix"
+)
+
+// ProtectRule matches paths that must never be deleted, moved or trashed.
+type ProtectRule struct {
+	kind    string
+	pattern string
+	re      *regexp.Regexp
+}
+
+// ParseProtectRule parses a rule in the form kind:pattern where kind is one of
+//
+//	glob:   matched against the full path and the file name, e.g. glob:*-small.jpg
+//	regex:  matched anywhere in the full path, e.g. regex:/originals?/
+//	prefix: everything in or under the dir, e.g. prefix:/photos/keep
+//
+// A rule without a kind is a glob.
+func ParseProtectRule(rule string) (ProtectRule, error) {
+	var kind, pattern, found = strings.Cut(rule, ":")
+	if !found || (kind != protectRegex && kind != protectPrefix && kind != protectGlob) {
+		kind, pattern = protectGlob, rule
+	}
+	if pattern == "" {
+		return ProtectRule{}, fmt.Errorf("%w: %q, empty pattern", ErrBadProtectRule, rule)
+	}
+
+	var p = ProtectRule{kind: kind, pattern: pattern}
+	switch kind {
+	case protectRegex:
+		var re, err = regexp.Compile(pattern)
+		if err != nil {
+			return ProtectRule{}, fmt.Errorf("%w: %q, err: %w", ErrBadProtectRule, rule, err)
+		}
+		p.re = re
+	case protectPrefix:
+		var abs, err = filepath.Abs(pattern)
+		if err != nil {
+			return ProtectRule{}, fmt.Errorf("%w: %q, err: %w", ErrBadProtectRule, rule, err)
+		}
+		p.pattern = abs
+	default:
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return ProtectRule{}, fmt.Errorf("%w: %q, err: %w", ErrBadProtectRule, rule, err)
+		}
+	}
+
+	return p, nil
+}
+
+// String fulfils the fmt.Stringer interface, it is the rule as it would be written.
+func (p ProtectRule) String() string {
+	return p.kind + ":" + p.pattern
+}
+
+// Match returns true if the path is protected by this rule.
+func (p ProtectRule) Match(path string) bool {
+	switch p.kind {
+	case protectRegex:
+		return p.re.MatchString(path)
+	case protectPrefix:
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		return path == p.pattern || strings.HasPrefix(path, p.pattern+string(filepath.Separator))
+	default:
+		for _, name := range []string{path, filepath.Base(path)} {
+			if matched, _ := filepath.Match(p.pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Protection is every protect rule in effect.
+type Protection []ProtectRule
+
+// ParseProtection parses a list of rules.
+func ParseProtection(rules ...string) (Protection, error) {
+	var protection = make(Protection, 0, len(rules))
+	for _, rule := range rules {
+		var p, err = ParseProtectRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		protection = append(protection, p)
+	}
+	return protection, nil
+}
+
+// LoadProtectFile reads rules from a file, one per line. Blank lines and lines starting with # are ignored.
+func LoadProtectFile(fileName string) (Protection, error) {
+	// #nosec G304: fileName is given to us by the user.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open protect file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only, nothing to flush
+	}()
+
+	var protection Protection
+	var scanner = bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var rule = strings.TrimSpace(scanner.Text())
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		var p, err = ParseProtectRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("protect file: %s, line %d, err: %w", fileName, line, err)
+		}
+		protection = append(protection, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read protect file: %s, err: %w", fileName, err)
+	}
+
+	return protection, nil
+}
+
+// Match returns the first rule protecting the path.
+func (p Protection) Match(path string) (ProtectRule, bool) {
+	for _, rule := range p {
+		if rule.Match(path) {
+			return rule, true
+		}
+	}
+	return ProtectRule{}, false
+}
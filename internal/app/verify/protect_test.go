@@ -0,0 +1,50 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtection(t *testing.T) {
+	t.Parallel()
+
+	var protection, err = ParseProtection("*-small.jpg", "regex:/originals?/", "prefix:/photos/keep/")
+	assert.NoError(t, err)
+
+	for path, expected := range map[string]string{
+		"/a/b/iceland-small.jpg":     "glob:*-small.jpg",
+		"/a/original/iceland.jpg":    "regex:/originals?/",
+		"/photos/keep/iceland.jpg":   "prefix:/photos/keep",
+		"/photos/keep/a/b/c.jpg":     "prefix:/photos/keep",
+		"/photos/keep":               "prefix:/photos/keep",
+		"/photos/keeper/iceland.jpg": "",
+		"/a/b/iceland.jpg":           "",
+	} {
+		var rule, protected = protection.Match(path)
+		assert.Equal(t, expected != "", protected, path)
+		if protected {
+			assert.Equal(t, expected, rule.String(), path)
+		}
+	}
+
+	for _, bad := range []string{"", "glob:", "regex:(", "glob:[", "prefix:"} {
+		_, err = ParseProtectRule(bad)
+		assert.ErrorIs(t, err, ErrBadProtectRule, bad)
+	}
+
+	var rulesFile = filepath.Join(t.TempDir(), "protect.txt")
+	assert.NoError(t, os.WriteFile(rulesFile, []byte("# never touch these\n\n*-small.jpg\n  regex:\\.png$\n"), 0600))
+	protection, err = LoadProtectFile(rulesFile)
+	assert.NoError(t, err)
+	assert.Len(t, protection, 2)
+	_, protected := protection.Match("/a/b.png")
+	assert.True(t, protected)
+
+	assert.NoError(t, os.WriteFile(rulesFile, []byte("ok.jpg\nregex:(\n"), 0600))
+	_, err = LoadProtectFile(rulesFile)
+	assert.ErrorIs(t, err, ErrBadProtectRule)
+	assert.Contains(t, err.Error(), "line 2")
+}
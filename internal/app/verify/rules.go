@@ -0,0 +1,113 @@
+// Package verify holds the decision logic used by the verify tool to act on
+// the duplicate pairs found by nsquared and uniqdirs.
+package verify
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// aspectTolerance is how far apart two aspect ratios can be and still be considered the same,
+// resizing rounds the dimensions so they are rarely exact.
+const aspectTolerance = 0.01
+
+// Outcome is what should happen to a pair.
+type Outcome int
+
+const (
+	// Queue means a human needs to look at the pair.
+	Queue Outcome = iota
+	// Apply means the small image can be acted on without review.
+	Apply
+	// Skip means the pair must not be touched.
+	Skip
+)
+
+// String fulfils the fmt.Stringer interface.
+func (o Outcome) String() string {
+	switch o {
+	case Apply:
+		return "apply"
+	case Skip:
+		return "skip"
+	default:
+		return "queue"
+	}
+}
+
+// Rules decide which pairs can be applied without a human looking at them.
+type Rules struct {
+	// MaxDistance is the largest hamming distance that is applied automatically, < 0 disables auto apply.
+	MaxDistance int
+	// SameAspect requires both images to have the same aspect ratio to be applied automatically.
+	SameAspect bool
+	// Protect are the paths that are never touched.
+	Protect Protection
+}
+
+// Enabled returns true if the rules can apply anything.
+func (r Rules) Enabled() bool {
+	return r.MaxDistance >= 0
+}
+
+// Evaluate decides the outcome of a pair and returns a human readable reason for it.
+func (r Rules) Evaluate(pair logger.DeleteEntry) (Outcome, string) {
+	if rule, protected := r.Protect.Match(pair.Small); protected {
+		return Skip, fmt.Sprintf("protected by %q", rule)
+	}
+
+	if !r.Enabled() {
+		return Queue, "auto apply disabled"
+	}
+	if pair.SmallInfo == nil || pair.BigInfo == nil {
+		return Queue, "distance unknown, log predates snapshots"
+	}
+	if pair.Distance > r.MaxDistance {
+		return Queue, fmt.Sprintf("distance %d > %d", pair.Distance, r.MaxDistance)
+	}
+
+	if r.SameAspect {
+		bigRatio, err := aspectRatio(pair.Big)
+		if err != nil {
+			return Queue, err.Error()
+		}
+		smallRatio, err := aspectRatio(pair.Small)
+		if err != nil {
+			return Queue, err.Error()
+		}
+		if math.Abs(bigRatio-smallRatio) > aspectTolerance*bigRatio {
+			return Queue, fmt.Sprintf("aspect ratio %.3f != %.3f", bigRatio, smallRatio)
+		}
+	}
+
+	return Apply, fmt.Sprintf("distance %d <= %d", pair.Distance, r.MaxDistance)
+}
+
+// aspectRatio reads just the image header to get width / height.
+func aspectRatio(fileName string) (float64, error) {
+	// #nosec G304: fileName comes from the delete log written by nsquared or uniqdirs.
+	var f, err = os.Open(fileName)
+	if err != nil {
+		return 0, fmt.Errorf("unable to open file: %s, err: %w", fileName, err)
+	}
+	defer func() {
+		_ = f.Close() // read only, nothing to flush
+	}()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, fmt.Errorf("unable to decode image config: %s, err: %w", fileName, err)
+	}
+	if config.Height == 0 {
+		return 0, fmt.Errorf("image has no height: %s", fileName)
+	}
+
+	return float64(config.Width) / float64(config.Height), nil
+}
@@ -0,0 +1,71 @@
+package verify
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesEvaluate(t *testing.T) {
+	t.Parallel()
+
+	var square = filepath.Join(t.TempDir(), "square.png")
+	f, err := os.Create(square)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, image.NewGray(image.Rect(0, 0, 10, 10))))
+	assert.NoError(t, f.Close())
+
+	var snap = &logger.FileSnapshot{}
+	var pair = logger.DeleteEntry{
+		Big:       "../imagedup/testimages/iceland.jpg",
+		Small:     "../imagedup/testimages/iceland-small.jpg",
+		Distance:  2,
+		BigInfo:   snap,
+		SmallInfo: snap,
+	}
+
+	var rules = Rules{MaxDistance: -1}
+	var outcome, _ = rules.Evaluate(pair)
+	assert.Equal(t, Queue, outcome)
+
+	rules = Rules{MaxDistance: 2, SameAspect: true}
+	outcome, _ = rules.Evaluate(pair)
+	assert.Equal(t, Apply, outcome)
+
+	rules = Rules{MaxDistance: 1}
+	outcome, reason := rules.Evaluate(pair)
+	assert.Equal(t, Queue, outcome)
+	assert.Equal(t, "distance 2 > 1", reason)
+
+	protect, err := ParseProtection("*-small.jpg")
+	assert.NoError(t, err)
+	rules = Rules{MaxDistance: 2, Protect: protect}
+	outcome, reason = rules.Evaluate(pair)
+	assert.Equal(t, Skip, outcome)
+	assert.Equal(t, `protected by "glob:*-small.jpg"`, reason)
+
+	var squarePair = pair
+	squarePair.Small = square
+	rules = Rules{MaxDistance: 2, SameAspect: true}
+	outcome, _ = rules.Evaluate(squarePair)
+	assert.Equal(t, Queue, outcome)
+
+	var legacy = logger.DeleteEntry{Big: pair.Big, Small: pair.Small}
+	outcome, _ = rules.Evaluate(legacy)
+	assert.Equal(t, Queue, outcome)
+}
+
+func TestSummary(t *testing.T) {
+	t.Parallel()
+
+	var s = Summary{Applied: 1, BytesReclaimed: 1024}
+	s.Add(Summary{Queued: 2, Skipped: 3, BytesReclaimed: 512})
+	assert.Equal(t, "applied: 1, queued: 2, skipped: 3, reclaimed: 1.5 KiB", s.String())
+	s.Add(Summary{Failed: 1})
+	assert.Equal(t, "applied: 1, queued: 2, skipped: 3, failed: 1, reclaimed: 1.5 KiB", s.String())
+}
@@ -0,0 +1,207 @@
+package verify
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+)
+
+// ErrBadSortOrder is returned when parsing a sort order we do not support.
+var ErrBadSortOrder = errors.New("unknown sort order")
+
+// ErrBadFilter is returned when a filter expression can not be parsed.
+var ErrBadFilter = errors.New("invalid filter")
+
+// SortOrder is the order pairs are reviewed in.
+type SortOrder string
+
+const (
+	// SortLog keeps the order of the log, which depends on how the workers that wrote it were scheduled.
+	SortLog SortOrder = "log"
+	// SortDistance puts the surest pairs, with the smallest distance, first.
+	SortDistance SortOrder = "distance"
+	// SortSavings puts the pairs that reclaim the most bytes first.
+	SortSavings SortOrder = "savings"
+	// SortDir groups the pairs by the dir of the image that would be deleted.
+	SortDir SortOrder = "dir"
+)
+
+// ParseSortOrder parses the name of a sort order, empty is SortLog.
+func ParseSortOrder(name string) (SortOrder, error) {
+	switch order := SortOrder(strings.ToLower(name)); order {
+	case "":
+		return SortLog, nil
+	case SortLog, SortDistance, SortSavings, SortDir:
+		return order, nil
+	default:
+		return SortLog, fmt.Errorf("%w: %s", ErrBadSortOrder, name)
+	}
+}
+
+// Filter is a single condition a pair has to meet, e.g. distance<=3, dir=/photos/2019 or small.size>1MB.
+type Filter struct {
+	field string
+	op    string
+	value string
+	n     int64
+}
+
+// filterRegex splits a filter into field, operator and value, two character operators first so <= is not read as <.
+var filterRegex = regexp.MustCompile(`^\s*([a-z.]+)\s*(<=|>=|!=|=|<|>)\s*(.+?)\s*$`)
+
+// ParseFilter parses a filter expression. The fields are:
+//
+//	distance               hamming distance between the images, pairs from logs without it never match
+//	dir                    = or != a dir, matches if the image that would be deleted is in or under it
+//	small.size, big.size   file size, with an optional B, KB, MB or GB suffix, all powers of 1024
+func ParseFilter(expr string) (Filter, error) {
+	var match = filterRegex.FindStringSubmatch(expr)
+	if match == nil {
+		return Filter{}, fmt.Errorf("%w: %q, expected field, operator and value e.g. distance<=3", ErrBadFilter, expr)
+	}
+	var f = Filter{field: match[1], op: match[2], value: match[3]}
+
+	var err error
+	switch f.field {
+	case "dir":
+		if f.op != "=" && f.op != "!=" {
+			return Filter{}, fmt.Errorf("%w: %q, dir can only be compared with = or !=", ErrBadFilter, expr)
+		}
+		if f.value, err = filepath.Abs(f.value); err != nil {
+			return Filter{}, fmt.Errorf("%w: %q, err: %w", ErrBadFilter, expr, err)
+		}
+	case "distance":
+		f.n, err = strconv.ParseInt(f.value, 10, 64)
+	case "small.size", "big.size":
+		f.n, err = filelist.ParseBytes(f.value)
+	default:
+		return Filter{}, fmt.Errorf("%w: %q, unknown field %s", ErrBadFilter, expr, f.field)
+	}
+	if err != nil {
+		return Filter{}, fmt.Errorf("%w: %q, err: %w", ErrBadFilter, expr, err)
+	}
+
+	return f, nil
+}
+
+// String fulfils the fmt.Stringer interface.
+func (f Filter) String() string {
+	return f.field + f.op + f.value
+}
+
+// Match returns true if the pair meets the condition.
+func (f Filter) Match(pair logger.DeleteEntry) bool {
+	switch f.field {
+	case "dir":
+		var small, err = filepath.Abs(pair.Small)
+		if err != nil {
+			small = pair.Small
+		}
+		var under = strings.HasPrefix(small, strings.TrimSuffix(f.value, string(filepath.Separator))+string(filepath.Separator))
+		return under == (f.op == "=")
+	case "distance":
+		if !distanceKnown(pair) {
+			return false
+		}
+		return compare(int64(pair.Distance), f.op, f.n)
+	case "small.size":
+		var size, known = fileSize(pair.Small, pair.SmallInfo)
+		return known && compare(size, f.op, f.n)
+	default: // big.size
+		var size, known = fileSize(pair.Big, pair.BigInfo)
+		return known && compare(size, f.op, f.n)
+	}
+}
+
+// compare applies the operator to a and b.
+func compare(a int64, op string, b int64) bool {
+	switch op {
+	case "<=":
+		return a <= b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	case "!=":
+		return a != b
+	default:
+		return a == b
+	}
+}
+
+// distanceKnown returns true if the log recorded the distance, logs written before snapshots always wrote 0.
+func distanceKnown(pair logger.DeleteEntry) bool {
+	return pair.BigInfo != nil || pair.SmallInfo != nil
+}
+
+// fileSize returns the size recorded at scan time, or the current size for logs that predate snapshots.
+func fileSize(fileName string, snapshot *logger.FileSnapshot) (int64, bool) {
+	if snapshot != nil && !snapshot.ModTime.IsZero() {
+		return snapshot.Size, true
+	}
+	if info, err := os.Stat(fileName); err == nil {
+		return info.Size(), true
+	}
+	return 0, false
+}
+
+// Selection decides which pairs of a log are worked through and in what order.
+type Selection struct {
+	Sort    SortOrder
+	Filters []Filter
+}
+
+// Apply returns the pairs that match every filter in the selection's order. Pairs that sort the same keep
+// the order of the log, so running the same selection twice, e.g. when resuming, gives the same result.
+func (q Selection) Apply(pairs []logger.DeleteEntry) []logger.DeleteEntry {
+	var queued = make([]logger.DeleteEntry, 0, len(pairs))
+	for _, pair := range pairs {
+		if !slices.ContainsFunc(q.Filters, func(f Filter) bool { return !f.Match(pair) }) {
+			queued = append(queued, pair)
+		}
+	}
+
+	switch q.Sort {
+	case SortDistance:
+		slices.SortStableFunc(queued, func(a, b logger.DeleteEntry) int {
+			// pairs without a distance are the least sure, they go last
+			if c := cmp.Compare(boolRank(!distanceKnown(a)), boolRank(!distanceKnown(b))); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Distance, b.Distance)
+		})
+	case SortSavings:
+		var sizes = make(map[string]int64, len(queued))
+		for _, pair := range queued {
+			sizes[pair.Small], _ = fileSize(pair.Small, pair.SmallInfo)
+		}
+		slices.SortStableFunc(queued, func(a, b logger.DeleteEntry) int {
+			return cmp.Compare(sizes[b.Small], sizes[a.Small])
+		})
+	case SortDir:
+		slices.SortStableFunc(queued, func(a, b logger.DeleteEntry) int {
+			return cmp.Or(cmp.Compare(filepath.Dir(a.Small), filepath.Dir(b.Small)), cmp.Compare(a.Small, b.Small))
+		})
+	}
+
+	return queued
+}
+
+// boolRank sorts false before true.
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package verify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/pkg/imagedup/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelection(t *testing.T) {
+	t.Parallel()
+
+	var snapshot = func(size int64) *logger.FileSnapshot {
+		return &logger.FileSnapshot{Size: size, ModTime: time.Now()}
+	}
+	var pairs = []logger.DeleteEntry{
+		{Big: "/p/2020/a.jpg", Small: "/p/2020/b.jpg", Distance: 5, BigInfo: snapshot(3 << 20), SmallInfo: snapshot(2 << 20)},
+		{Big: "/p/2019/c.jpg", Small: "/p/2019/d.jpg", Distance: 1, BigInfo: snapshot(1 << 20), SmallInfo: snapshot(512 << 10)},
+		{Big: "/p/2019/e.jpg", Small: "/p/2019/x/f.jpg", Distance: 0}, // legacy, nothing known
+		{Big: "/p/2018/g.jpg", Small: "/p/2018/h.jpg", Distance: 3, BigInfo: snapshot(4 << 20), SmallInfo: snapshot(4 << 20)},
+	}
+	var smalls = func(pairs []logger.DeleteEntry) []string {
+		var names []string
+		for _, pair := range pairs {
+			names = append(names, pair.Small)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"/p/2019/d.jpg", "/p/2018/h.jpg", "/p/2020/b.jpg", "/p/2019/x/f.jpg"}, smalls(Selection{Sort: SortDistance}.Apply(pairs)))
+	assert.Equal(t, []string{"/p/2018/h.jpg", "/p/2020/b.jpg", "/p/2019/d.jpg", "/p/2019/x/f.jpg"}, smalls(Selection{Sort: SortSavings}.Apply(pairs)))
+	assert.Equal(t, []string{"/p/2018/h.jpg", "/p/2019/d.jpg", "/p/2019/x/f.jpg", "/p/2020/b.jpg"}, smalls(Selection{Sort: SortDir}.Apply(pairs)))
+	assert.Equal(t, smalls(pairs), smalls(Selection{}.Apply(pairs)))
+
+	for expr, expected := range map[string][]string{
+		"distance<=3":    {"/p/2019/d.jpg", "/p/2018/h.jpg"},
+		"distance != 1":  {"/p/2020/b.jpg", "/p/2018/h.jpg"},
+		"dir=/p/2019":    {"/p/2019/d.jpg", "/p/2019/x/f.jpg"},
+		"dir!=/p/2019/":  {"/p/2020/b.jpg", "/p/2018/h.jpg"},
+		"small.size>1MB": {"/p/2020/b.jpg", "/p/2018/h.jpg"},
+		"big.size<=1mb":  {"/p/2019/d.jpg"},
+	} {
+		var filter, err = ParseFilter(expr)
+		assert.NoError(t, err, expr)
+		assert.Equal(t, expected, smalls(Selection{Filters: []Filter{filter}}.Apply(pairs)), expr)
+	}
+
+	for _, bad := range []string{"", "distance", "distance<=x", "dir<5", "color=red", "small.size>lots"} {
+		var _, err = ParseFilter(bad)
+		assert.ErrorIs(t, err, ErrBadFilter, bad)
+	}
+
+	var _, err = ParseSortOrder("random")
+	assert.ErrorIs(t, err, ErrBadSortOrder)
+}
@@ -0,0 +1,34 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/filelist"
+)
+
+// Summary counts what happened to the pairs in a run.
+type Summary struct {
+	Applied        int
+	Queued         int
+	Skipped        int
+	Failed         int
+	BytesReclaimed int64
+}
+
+// Add merges another summary into this one.
+func (s *Summary) Add(other Summary) {
+	s.Applied += other.Applied
+	s.Queued += other.Queued
+	s.Skipped += other.Skipped
+	s.Failed += other.Failed
+	s.BytesReclaimed += other.BytesReclaimed
+}
+
+// String fulfils the fmt.Stringer interface.
+func (s Summary) String() string {
+	var failed string
+	if s.Failed > 0 {
+		failed = fmt.Sprintf(", failed: %d", s.Failed)
+	}
+	return fmt.Sprintf("applied: %d, queued: %d, skipped: %d%s, reclaimed: %s", s.Applied, s.Queued, s.Skipped, failed, filelist.FormatBytes(s.BytesReclaimed))
+}
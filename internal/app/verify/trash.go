@@ -0,0 +1,86 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTrashUnsupported is returned on platforms where we do not know where the trash is.
+var ErrTrashUnsupported = errors.New("trash is not supported on this os, use -quarantine-dir instead")
+
+// trashDir returns the dir files are moved to when trashed.
+// On linux this is the freedesktop.org home trash, on macOS ~/.Trash.
+func trashDir() (string, error) {
+	var home, err = os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find home dir, err: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, ".Trash"), nil
+	case "linux", "freebsd":
+		var dataHome = os.Getenv("XDG_DATA_HOME")
+		if dataHome == "" {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dataHome, "Trash", "files"), nil
+	default:
+		return "", ErrTrashUnsupported
+	}
+}
+
+// trashDest picks a name in the trash that is not already taken, on disk or by reserved, e.g. the files
+// a plan trashes once it is run.
+func trashDest(fileName string, reserved map[string]struct{}) (string, error) {
+	var dir, err = trashDir()
+	if err != nil {
+		return "", err
+	}
+
+	var ext = filepath.Ext(fileName)
+	var base = strings.TrimSuffix(filepath.Base(fileName), ext)
+	var dest = filepath.Join(dir, base+ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dest); errors.Is(err, os.ErrNotExist) {
+			if _, taken := reserved[dest]; !taken {
+				return dest, nil
+			}
+		}
+		dest = filepath.Join(dir, base+"."+strconv.Itoa(i)+ext)
+	}
+}
+
+// trashInfoFile returns the .trashinfo file that goes with a file in the freedesktop.org trash, or "" on other platforms.
+func trashInfoFile(dest string) string {
+	if filepath.Base(filepath.Dir(dest)) != "files" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(filepath.Dir(dest)), "info", filepath.Base(dest)+".trashinfo")
+}
+
+// writeTrashInfo records where a trashed file came from so file managers can restore it.
+func writeTrashInfo(original, dest string) error {
+	var infoFile = trashInfoFile(dest)
+	if infoFile == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(infoFile), 0700); err != nil {
+		return fmt.Errorf("unable to create trash info dir: %s, err: %w", filepath.Dir(infoFile), err)
+	}
+
+	var escaped = (&url.URL{Path: original}).EscapedPath()
+	var info = fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, time.Now().Format("2006-01-02T15:04:05"))
+	if err := os.WriteFile(infoFile, []byte(info), 0600); err != nil {
+		return fmt.Errorf("unable to write trash info file: %s, err: %w", infoFile, err)
+	}
+	return nil
+}
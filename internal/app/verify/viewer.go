@@ -0,0 +1,163 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedViewer is returned when a viewer template can not be used.
+var ErrUnsupportedViewer = errors.New("unsupported viewer command")
+
+// Placeholders recognised in viewer templates.
+const (
+	placeholderBig   = "{big}"
+	placeholderSmall = "{small}"
+	placeholderPath  = "{}"
+)
+
+// Viewer is a parsed viewer command template, e.g. `feh --title %f -- {big} {small}` opens both images
+// with a single command and `eog {}` runs one command per image. The template is split into argv the
+// same way a shell would split words but no shell is ever involved, so file names can not inject anything.
+type Viewer struct {
+	argv []string
+	pair bool
+}
+
+// ParseViewer parses a viewer template.
+func ParseViewer(template string) (Viewer, error) {
+	var argv, err = splitArgs(template)
+	if err != nil {
+		return Viewer{}, fmt.Errorf("%w: %s, err: %w", ErrUnsupportedViewer, template, err)
+	}
+	if len(argv) == 0 {
+		return Viewer{}, fmt.Errorf("%w: empty command", ErrUnsupportedViewer)
+	}
+
+	var hasPair, hasPath bool
+	for _, arg := range argv[1:] {
+		hasPair = hasPair || strings.Contains(arg, placeholderBig) || strings.Contains(arg, placeholderSmall)
+		hasPath = hasPath || strings.Contains(arg, placeholderPath)
+	}
+	if strings.ContainsAny(argv[0], "{}") {
+		return Viewer{}, fmt.Errorf("%w: %s, the command itself can not be a placeholder", ErrUnsupportedViewer, template)
+	}
+	if hasPair && hasPath {
+		return Viewer{}, fmt.Errorf("%w: %s, use either {big} and {small} or {}, not both", ErrUnsupportedViewer, template)
+	}
+	if !hasPair && !hasPath {
+		argv = append(argv, placeholderPath)
+	}
+
+	return Viewer{argv: argv, pair: hasPair}, nil
+}
+
+// Commands returns the argv of every command that needs to be started to show both images.
+func (v Viewer) Commands(big, small string) [][]string {
+	if v.pair {
+		var replacer = strings.NewReplacer(placeholderBig, big, placeholderSmall, small)
+		return [][]string{v.expand(replacer)}
+	}
+
+	return [][]string{
+		v.expand(strings.NewReplacer(placeholderPath, big)),
+		v.expand(strings.NewReplacer(placeholderPath, small)),
+	}
+}
+
+// GroupCommands returns the argv of every command that needs to be started to show all the images of a cluster.
+// With a pair template {big} is the first image and an argument that is exactly {small} becomes all the others,
+// so `feh -- {big} {small}` opens the whole cluster in one window. Otherwise the command is run once per image.
+func (v Viewer) GroupCommands(paths []string) [][]string {
+	if len(paths) == 0 {
+		return nil
+	}
+	if !v.pair {
+		var commands = make([][]string, 0, len(paths))
+		for _, path := range paths {
+			commands = append(commands, v.expand(strings.NewReplacer(placeholderPath, path)))
+		}
+		return commands
+	}
+	if len(paths) == 1 {
+		return v.Commands(paths[0], paths[0])
+	}
+
+	var replacer = strings.NewReplacer(placeholderBig, paths[0], placeholderSmall, paths[1])
+	var argv = []string{v.argv[0]}
+	for _, arg := range v.argv[1:] {
+		if arg == placeholderSmall {
+			argv = append(argv, paths[1:]...)
+		} else {
+			argv = append(argv, replacer.Replace(arg))
+		}
+	}
+	return [][]string{argv}
+}
+
+// expand fills in the placeholders of every argument but the command.
+func (v Viewer) expand(replacer *strings.Replacer) []string {
+	var argv = make([]string, len(v.argv))
+	argv[0] = v.argv[0]
+	for i, arg := range v.argv[1:] {
+		argv[i+1] = replacer.Replace(arg)
+	}
+	return argv
+}
+
+// splitArgs splits a command line into words following the POSIX shell quoting rules for
+// single quotes, double quotes and backslashes. Nothing else, e.g. $ or globs, is interpreted.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	var inWord, escaped bool
+	var quote rune
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+
+	return args, nil
+}
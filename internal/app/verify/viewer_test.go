@@ -0,0 +1,40 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseViewer(t *testing.T) {
+	t.Parallel()
+
+	var viewer, err = ParseViewer(`feh --title "%f  (%n)" -- {big} {small}`)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"feh", "--title", "%f  (%n)", "--", "/a/big.jpg", "/a/it's $(small).jpg"}}, viewer.Commands("/a/big.jpg", "/a/it's $(small).jpg"))
+
+	viewer, err = ParseViewer("eog {}")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"eog", "big.jpg"}, {"eog", "small.jpg"}}, viewer.Commands("big.jpg", "small.jpg"))
+
+	// no placeholder, the file goes on the end
+	viewer, err = ParseViewer(`gthumb --new-window`)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"gthumb", "--new-window", "big.jpg"}, {"gthumb", "--new-window", "small.jpg"}}, viewer.Commands("big.jpg", "small.jpg"))
+
+	viewer, err = ParseViewer(`sxiv 'file with spaces' it\'s {}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sxiv", "file with spaces", "it's", "x"}, viewer.Commands("x", "y")[0])
+
+	viewer, err = ParseViewer(`feh --title "{big}" -- {big} {small}`)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"feh", "--title", "a", "--", "a", "b", "c"}}, viewer.GroupCommands([]string{"a", "b", "c"}))
+	viewer, err = ParseViewer("eog")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"eog", "a"}, {"eog", "b"}, {"eog", "c"}}, viewer.GroupCommands([]string{"a", "b", "c"}))
+
+	for _, bad := range []string{"", "   ", "feh {big} {}", "{} big", `feh "unterminated`, `feh \`} {
+		_, err = ParseViewer(bad)
+		assert.ErrorIs(t, err, ErrUnsupportedViewer, bad)
+	}
+}
@@ -4,23 +4,54 @@ package logger
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
 )
 
+// ErrNotDeleteLog is returned when appending to a file that is not a delete log.
+var ErrNotDeleteLog = errors.New("not a delete log")
+
 // DeleteLogger logs the duplicate file pairs and can read with the verify tool.
 type DeleteLogger struct {
 	FileName   string
 	LogFile    *os.File
-	FirstEntry bool // used to tell if we should write a ',' after the entry
+	FirstEntry bool                // used to tell if we should write a ',' after the entry
+	logged     map[string]struct{} // pairs already in the log, only set when appending
 }
 
-// DeleteEntry is a duplicate file pair.
+// DeleteEntry is a duplicate file pair. BigInfo and SmallInfo are missing from logs written by older versions.
 type DeleteEntry struct {
-	Big   string `json:"big"`
-	Small string `json:"small"`
+	Big        string        `json:"big"`
+	Small      string        `json:"small"`
+	Distance   int           `json:"distance"`
+	KeepReason string        `json:"keep_reason,omitempty"`
+	Reference  bool          `json:"reference,omitempty"` // Big is in a reference library and must never be deleted
+	BigInfo    *FileSnapshot `json:"big_info,omitempty"`
+	SmallInfo  *FileSnapshot `json:"small_info,omitempty"`
+}
+
+// CheckIntegrity makes sure neither side of the pair has changed since it was logged.
+// Entries without snapshots are only checked for existence.
+func (de DeleteEntry) CheckIntegrity() error {
+	for _, side := range []struct {
+		path string
+		snap *FileSnapshot
+	}{{de.Big, de.BigInfo}, {de.Small, de.SmallInfo}} {
+		if side.snap == nil {
+			if _, err := os.Stat(side.path); err != nil {
+				return fmt.Errorf("unable to stat file: %s, err: %w", side.path, err)
+			}
+			continue
+		}
+		if err := side.snap.Check(side.path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // NewDeleteLogger creates a new DeleteLogger and deletes the log file if it already exists.
@@ -50,6 +81,49 @@ func NewDeleteLogger(filename string) (*DeleteLogger, error) {
 	return &DeleteLogger{FileName: filename, LogFile: file, FirstEntry: true}, nil
 }
 
+// AppendDeleteLogger opens an existing log to add more entries to it, entries already in the log are not
+// written again. A log that was never closed, e.g. because the process was killed, is cut after its last
+// complete entry. If the log does not exist a new one is created.
+func AppendDeleteLogger(filename string) (*DeleteLogger, error) {
+	// #nosec G304: filename is provided by caller and points to a local log file
+	var file, err = os.OpenFile(filename, os.O_RDWR, 0600)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewDeleteLogger(filename)
+	} else if err != nil {
+		return nil, fmt.Errorf("DeleteLogger could not open file: %s, err: %w", filename, err)
+	}
+
+	var dl = &DeleteLogger{FileName: filename, LogFile: file, FirstEntry: true, logged: make(map[string]struct{})}
+	var decoder = json.NewDecoder(file)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		_ = file.Close()
+		return nil, fmt.Errorf("DeleteLogger could not find the leading [ in file: %s, err: %w", filename, ErrNotDeleteLog)
+	}
+
+	var end = decoder.InputOffset()
+	for decoder.More() {
+		var entry DeleteEntry
+		if err := decoder.Decode(&entry); err != nil {
+			break // cut off mid entry
+		}
+		dl.logged[entry.Big+"\x00"+entry.Small] = struct{}{}
+		dl.FirstEntry = false
+		end = decoder.InputOffset()
+	}
+
+	// drop the trailing ] or half written entry so new entries can follow the last complete one
+	if err := file.Truncate(end); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("DeleteLogger could not truncate file: %s, err: %w", filename, err)
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("DeleteLogger could not seek in file: %s, err: %w", filename, err)
+	}
+
+	return dl, nil
+}
+
 // ReadDeleteLogFile reads the entire file and returns a slice of DeleteEntries.
 func ReadDeleteLogFile(filename string) ([]DeleteEntry, error) {
 
@@ -72,21 +146,53 @@ func ReadDeleteLogFile(filename string) ([]DeleteEntry, error) {
 func (dl *DeleteLogger) LogResult(result hash.DiffResult) error {
 	var entry DeleteEntry
 
-	if result.OneArea > result.TwoArea {
+	if result.TwoIsRef {
+		entry = DeleteEntry{
+			Big:        result.Two,
+			Small:      result.One,
+			KeepReason: "in the reference library",
+			Reference:  true,
+			BigInfo:    NewHashSnapshot(result.TwoSize, result.TwoMTime, result.TwoHash),
+			SmallInfo:  NewHashSnapshot(result.OneSize, result.OneMTime, result.OneHash),
+		}
+	} else if result.OneArea > result.TwoArea {
 		entry = DeleteEntry{
-			Big:   result.One,
-			Small: result.Two,
+			Big:        result.One,
+			Small:      result.Two,
+			KeepReason: fmt.Sprintf("larger area: %d > %d pixels", result.OneArea, result.TwoArea),
+			BigInfo:    NewHashSnapshot(result.OneSize, result.OneMTime, result.OneHash),
+			SmallInfo:  NewHashSnapshot(result.TwoSize, result.TwoMTime, result.TwoHash),
 		}
 	} else {
 		entry = DeleteEntry{
-			Big:   result.Two,
-			Small: result.One,
+			Big:        result.Two,
+			Small:      result.One,
+			KeepReason: fmt.Sprintf("larger area: %d > %d pixels", result.TwoArea, result.OneArea),
+			BigInfo:    NewHashSnapshot(result.TwoSize, result.TwoMTime, result.TwoHash),
+			SmallInfo:  NewHashSnapshot(result.OneSize, result.OneMTime, result.OneHash),
+		}
+		if result.OneArea == result.TwoArea {
+			entry.KeepReason = fmt.Sprintf("same area: %d pixels, picked arbitrarily", result.OneArea)
 		}
 	}
+	entry.Distance = result.Distance
+
+	return dl.LogEntry(entry)
+}
+
+// LogEntry writes an already built entry to the log, this is used to copy entries between logs.
+func (dl *DeleteLogger) LogEntry(entry DeleteEntry) error {
+	if dl.logged != nil {
+		var key = entry.Big + "\x00" + entry.Small
+		if _, found := dl.logged[key]; found {
+			return nil
+		}
+		dl.logged[key] = struct{}{}
+	}
 
 	js, err := json.Marshal(entry)
 	if err != nil {
-		return fmt.Errorf("DeleteLogger could not marshal DiffResult json, file: %s, err: %w", dl.FileName, err)
+		return fmt.Errorf("DeleteLogger could not marshal DeleteEntry json, file: %s, err: %w", dl.FileName, err)
 	}
 
 	if !dl.FirstEntry {
@@ -105,6 +211,11 @@ func (dl *DeleteLogger) LogResult(result hash.DiffResult) error {
 	return nil
 }
 
+// Empty returns true when no entry was written to the log.
+func (dl *DeleteLogger) Empty() bool {
+	return dl.FirstEntry
+}
+
 // Close writes the trailing ] and closes the log file.
 func (dl *DeleteLogger) Close() error {
 	var _, err = dl.LogFile.WriteString("]")
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
@@ -42,9 +43,76 @@ func TestCustomLogger(t *testing.T) {
 
 	assert.Equal(t, "fileone", deletes[0].Big)
 	assert.Equal(t, "filetwo", deletes[0].Small)
+	assert.Equal(t, "larger area: 20 > 10 pixels", deletes[0].KeepReason)
 
 	assert.Equal(t, "fileone", deletes[1].Small)
 	assert.Equal(t, "filetwo", deletes[1].Big)
 
 	assert.NoError(t, os.RemoveAll(filename))
 }
+
+func TestAppendDeleteLogger(t *testing.T) {
+	t.Parallel()
+
+	var filename = filepath.Join(t.TempDir(), "delete.json")
+
+	// a missing log is created
+	var logger, err = AppendDeleteLogger(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, logger.LogEntry(DeleteEntry{Big: "a", Small: "b"}))
+	assert.NoError(t, logger.Close())
+
+	logger, err = AppendDeleteLogger(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, logger.LogEntry(DeleteEntry{Big: "a", Small: "b"}), "already logged, skipped")
+	assert.NoError(t, logger.LogEntry(DeleteEntry{Big: "c", Small: "d"}))
+	assert.NoError(t, logger.Close())
+
+	deletes, err := ReadDeleteLogFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, []DeleteEntry{{Big: "a", Small: "b"}, {Big: "c", Small: "d"}}, deletes)
+
+	// killed mid entry, the log was never closed
+	assert.NoError(t, os.WriteFile(filename, []byte(`[{"big":"a","small":"b","distance":1},{"big":"c","sm`), 0600))
+	logger, err = AppendDeleteLogger(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, logger.LogEntry(DeleteEntry{Big: "c", Small: "d"}))
+	assert.NoError(t, logger.Close())
+
+	deletes, err = ReadDeleteLogFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, []DeleteEntry{{Big: "a", Small: "b", Distance: 1}, {Big: "c", Small: "d"}}, deletes)
+
+	// killed before the first entry
+	assert.NoError(t, os.WriteFile(filename, []byte(`[`), 0600))
+	logger, err = AppendDeleteLogger(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, logger.Close())
+	deletes, err = ReadDeleteLogFile(filename)
+	assert.NoError(t, err)
+	assert.Empty(t, deletes)
+
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"not":"a log"}`), 0600))
+	_, err = AppendDeleteLogger(filename)
+	assert.ErrorIs(t, err, ErrNotDeleteLog)
+}
+
+func TestLogResultReference(t *testing.T) {
+	t.Parallel()
+
+	var filename = filepath.Join(t.TempDir(), "delete.json")
+	var logger, err = NewDeleteLogger(filename)
+	assert.NoError(t, err)
+	assert.True(t, logger.Empty())
+
+	// the reference image is kept even though it is smaller
+	assert.NoError(t, logger.LogResult(hash.DiffResult{One: "incoming", Two: "archive", OneArea: 20, TwoArea: 10, TwoIsRef: true}))
+	assert.False(t, logger.Empty())
+	assert.NoError(t, logger.Close())
+
+	deletes, err := ReadDeleteLogFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "archive", deletes[0].Big)
+	assert.Equal(t, "incoming", deletes[0].Small)
+	assert.True(t, deletes[0].Reference)
+}
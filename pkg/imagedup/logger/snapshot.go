@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+)
+
+// ErrChangedSinceScan is returned when a file no longer matches the snapshot taken when it was logged.
+var ErrChangedSinceScan = errors.New("file changed since scan")
+
+// FileSnapshot is the state of a file at scan time, it is used to make sure
+// the file on disk is still the one that was compared before acting on it.
+type FileSnapshot struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    uint64    `json:"phash"`
+}
+
+// NewFileSnapshot stats the file and records its size and mtime alongside the given perceptual hash.
+// If the file cannot be stat'd only the hash is recorded.
+func NewFileSnapshot(fileName string, phash uint64) *FileSnapshot {
+	var snap = &FileSnapshot{Hash: phash}
+
+	if info, err := os.Stat(fileName); err == nil {
+		snap.Size = info.Size()
+		snap.ModTime = info.ModTime()
+	}
+
+	return snap
+}
+
+// NewHashSnapshot records the size and mtime the perceptual hash was calculated from, the file may have
+// changed since it was hashed so it is not stat'd again. Hashes cached by an older version did not record
+// them, only the hash is recorded then.
+func NewHashSnapshot(size int64, modTime time.Time, phash uint64) *FileSnapshot {
+	if modTime.IsZero() {
+		return &FileSnapshot{Hash: phash}
+	}
+	return &FileSnapshot{Size: size, ModTime: modTime, Hash: phash}
+}
+
+// Check compares the file on disk to the snapshot. Size and mtime are checked first as they are cheap,
+// if they match the perceptual hash is recalculated. Fields that were not recorded are not checked.
+// The returned error wraps ErrChangedSinceScan and lists every field that differs.
+func (s *FileSnapshot) Check(fileName string) error {
+	var info, err = os.Stat(fileName)
+	if err != nil {
+		return fmt.Errorf("unable to stat file: %s, err: %w", fileName, err)
+	}
+
+	var changes []string
+	if !s.ModTime.IsZero() {
+		if info.Size() != s.Size {
+			changes = append(changes, fmt.Sprintf("size %d -> %d", s.Size, info.Size()))
+		}
+		if !info.ModTime().Equal(s.ModTime) {
+			changes = append(changes, fmt.Sprintf("mtime %s -> %s", s.ModTime.Format(time.RFC3339), info.ModTime().Format(time.RFC3339)))
+		}
+	}
+
+	if len(changes) == 0 && s.Hash != 0 {
+		img, err := hash.HashFile(fileName)
+		if err != nil {
+			return fmt.Errorf("unable to rehash file: %s, err: %w", fileName, err)
+		}
+		if img.GetHash() != s.Hash {
+			changes = append(changes, fmt.Sprintf("phash %016x -> %016x", s.Hash, img.GetHash()))
+		}
+	}
+
+	if len(changes) > 0 {
+		return fmt.Errorf("%w: %s (%s)", ErrChangedSinceScan, fileName, strings.Join(changes, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kmulvey/imagedup/v2/internal/app/imagedup/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSnapshot(t *testing.T) {
+	t.Parallel()
+
+	var dir = t.TempDir()
+	var fileName = filepath.Join(dir, "iceland.jpg")
+	content, err := os.ReadFile("../../../internal/app/imagedup/testimages/iceland.jpg")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(fileName, content, 0600))
+
+	img, err := hash.HashFile(fileName)
+	assert.NoError(t, err)
+
+	var snap = NewFileSnapshot(fileName, img.GetHash())
+	assert.Equal(t, int64(len(content)), snap.Size)
+	assert.NoError(t, snap.Check(fileName))
+
+	// same content, different mtime
+	assert.NoError(t, os.Chtimes(fileName, time.Now(), snap.ModTime.Add(time.Hour)))
+	err = snap.Check(fileName)
+	assert.ErrorIs(t, err, ErrChangedSinceScan)
+	assert.Contains(t, err.Error(), "mtime")
+
+	// a different image dropped in its place
+	content, err = os.ReadFile("../../../internal/app/imagedup/testimages/trees.jpg")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(fileName, content, 0600))
+	err = snap.Check(fileName)
+	assert.ErrorIs(t, err, ErrChangedSinceScan)
+	assert.Contains(t, err.Error(), "size")
+
+	// only the hash was recorded
+	snap = &FileSnapshot{Hash: img.GetHash()}
+	err = snap.Check(fileName)
+	assert.ErrorIs(t, err, ErrChangedSinceScan)
+	assert.Contains(t, err.Error(), "phash")
+
+	var entry = DeleteEntry{Big: fileName, Small: filepath.Join(dir, "gone.jpg")}
+	assert.Error(t, entry.CheckIntegrity())
+}
+
+func TestHashSnapshot(t *testing.T) {
+	t.Parallel()
+
+	var fileName = filepath.Join(t.TempDir(), "iceland.jpg")
+	content, err := os.ReadFile("../../../internal/app/imagedup/testimages/iceland.jpg")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(fileName, content, 0600))
+
+	img, err := hash.HashFile(fileName)
+	assert.NoError(t, err)
+
+	// the file changes after it was hashed but before the pair is logged
+	assert.NoError(t, os.Chtimes(fileName, time.Now(), img.ModTime.Add(time.Hour)))
+	var snap = NewHashSnapshot(img.Size, img.ModTime, img.GetHash())
+	err = snap.Check(fileName)
+	assert.ErrorIs(t, err, ErrChangedSinceScan)
+	assert.Contains(t, err.Error(), "mtime")
+
+	// hashed by an older version, only the hash is checked
+	snap = NewHashSnapshot(0, time.Time{}, img.GetHash())
+	assert.Zero(t, snap.Size)
+	assert.NoError(t, snap.Check(fileName))
+}
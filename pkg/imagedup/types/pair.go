@@ -5,4 +5,7 @@ package types
 type Pair struct {
 	One string
 	Two string
+	Row int // index of One in the files list
+	// Reference is true when Two is from a reference library, those images are only compared and never deleted.
+	Reference bool
 }